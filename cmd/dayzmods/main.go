@@ -3,15 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/gc"
 	"github.com/example/dayz-standalone-mode-updater/internal/logging"
+	"github.com/example/dayz-standalone-mode-updater/internal/modlist"
 	"github.com/example/dayz-standalone-mode-updater/internal/orchestrator"
+	"github.com/example/dayz-standalone-mode-updater/internal/pbo"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
+	"github.com/example/dayz-standalone-mode-updater/internal/steamcmd"
 	"github.com/spf13/cobra"
 )
 
@@ -31,6 +40,10 @@ func newRootCmd() *cobra.Command {
 	root.AddCommand(newRunCmd())
 	root.AddCommand(newPrintSampleConfigCmd())
 	root.AddCommand(newPrintSampleStateCmd())
+	root.AddCommand(newGCCmd())
+	root.AddCommand(newInspectCmd())
+	root.AddCommand(newStatusCmd())
+	root.AddCommand(newHistoryCmd())
 
 	return root
 }
@@ -48,6 +61,14 @@ func newRunCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("load config: %w", err)
 			}
+			lock, err := state.Lock(cfg.StatePath)
+			if errors.Is(err, state.ErrLocked) {
+				return fmt.Errorf("another dayzmods process is using %s: %w", cfg.StatePath, err)
+			}
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
 
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 			defer stop()
@@ -61,6 +82,268 @@ func newRunCmd() *cobra.Command {
 	return cmd
 }
 
+func newGCCmd() *cobra.Command {
+	var configPath string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "gc --config <path> [--dry-run]",
+		Short: "Remove local mod copies no server references any more",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+
+			var report gc.Report
+			var runErr error
+			if dryRun {
+				// A dry run only reads state, so it is safe next to the daemon.
+				st, err := state.Load(cfg.StatePath)
+				if err != nil {
+					return fmt.Errorf("load state: %w", err)
+				}
+				report, runErr = gc.Run(cfg, &st, time.Now(), gc.Options{DryRun: true})
+			} else {
+				lock, err := state.Lock(cfg.StatePath)
+				if errors.Is(err, state.ErrLocked) {
+					return fmt.Errorf("the daemon is running; enable gc.enabled or stop it before running gc: %w", err)
+				}
+				if err != nil {
+					return err
+				}
+				defer lock.Unlock()
+				if err := state.NewFileStore(cfg.StatePath).Update(func(st *state.State) error {
+					report, runErr = gc.Run(cfg, st, time.Now(), gc.Options{})
+					return nil
+				}); err != nil {
+					return fmt.Errorf("update state: %w", err)
+				}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+			return runErr
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "config.json", "path to config.json")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be removed without deleting anything")
+	return cmd
+}
+
+func newInspectCmd() *cobra.Command {
+	var configPath string
+	var modID string
+	var withFiles bool
+	var extractDir string
+
+	cmd := &cobra.Command{
+		Use:   "inspect --config <path> --mod <workshop_id> [--files] [--extract-config <dir>]",
+		Short: "Report PBOs, signatures and keys of a local mod",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if modID == "" {
+				return fmt.Errorf("--mod is required")
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			st, err := state.Load(cfg.StatePath)
+			if err != nil {
+				return fmt.Errorf("load state: %w", err)
+			}
+			slug := st.Mods[modID].FolderSlug
+			if strings.TrimSpace(slug) == "" {
+				slug = "mod-" + modID
+			}
+
+			report, err := pbo.InspectMod(filepath.Join(cfg.Paths.LocalModsRoot, slug), pbo.InspectOptions{
+				Files:    withFiles,
+				Validate: pbo.ValidateOptions{AllowUnsigned: slices.Contains(cfg.Steam.UnsignedMods, modID)},
+			})
+			if err != nil {
+				return fmt.Errorf("inspect mod %s: %w", modID, err)
+			}
+			out := struct {
+				ModID      string `json:"mod_id"`
+				FolderSlug string `json:"folder_slug"`
+				pbo.ModReport
+				Extracted []string `json:"extracted,omitempty"`
+			}{ModID: modID, FolderSlug: slug, ModReport: report}
+
+			if extractDir != "" {
+				for _, info := range report.PBOs {
+					name, data, err := pbo.ExtractConfig(filepath.Join(report.Addons, info.File))
+					if errors.Is(err, os.ErrNotExist) {
+						continue
+					}
+					if err != nil {
+						return fmt.Errorf("extract config from %s: %w", info.File, err)
+					}
+					dest := filepath.Join(extractDir, strings.TrimSuffix(info.File, filepath.Ext(info.File)), name)
+					if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+						return err
+					}
+					if err := os.WriteFile(dest, data, 0o644); err != nil {
+						return err
+					}
+					out.Extracted = append(out.Extracted, dest)
+				}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "config.json", "path to config.json")
+	cmd.Flags().StringVar(&modID, "mod", "", "workshop ID of the mod to inspect")
+	cmd.Flags().BoolVar(&withFiles, "files", false, "include each PBO's file table")
+	cmd.Flags().StringVar(&extractDir, "extract-config", "", "write each PBO's config.cpp (or config.bin) below this directory")
+	return cmd
+}
+
+func newStatusCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "status --config <path>",
+		Short: "Show SteamCMD download progress and per-server sync state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			st, err := state.Load(cfg.StatePath)
+			if err != nil {
+				return fmt.Errorf("load state: %w", err)
+			}
+			progress, err := steamcmd.ReadProgress(cfg.Paths.LocalCacheRoot)
+			if err != nil {
+				return fmt.Errorf("read steamcmd progress: %w", err)
+			}
+
+			type serverStatus struct {
+				Stage              state.Stage `json:"stage"`
+				NeedsModUpdate     bool        `json:"needs_mod_update"`
+				NeedsShutdown      bool        `json:"needs_shutdown"`
+				ShutdownDeadlineAt *time.Time  `json:"shutdown_deadline_at,omitempty"`
+				LastError          string      `json:"last_error,omitempty"`
+				LastErrorStage     string      `json:"last_error_stage,omitempty"`
+				LastErrorAt        *time.Time  `json:"last_error_at,omitempty"`
+				LastSuccessSyncAt  *time.Time  `json:"last_success_sync_at,omitempty"`
+			}
+			type modStatus struct {
+				Title             string    `json:"title,omitempty"`
+				FolderSlug        string    `json:"folder_slug"`
+				WorkshopUpdatedAt time.Time `json:"workshop_updated_at"`
+				LocalUpdatedAt    time.Time `json:"local_updated_at"`
+				FileSize          int64     `json:"file_size,omitempty"`
+				PreviewURL        string    `json:"preview_url,omitempty"`
+				Tags              []string  `json:"tags,omitempty"`
+				ChildIDs          []string  `json:"children,omitempty"`
+				Banned            bool      `json:"banned,omitempty"`
+				BanReason         string    `json:"ban_reason,omitempty"`
+				Visibility        int       `json:"visibility,omitempty"`
+				WorkshopRevision  int64     `json:"workshop_revision,omitempty"`
+				Changelog         string    `json:"changelog,omitempty"`
+				ChangelogVersion  time.Time `json:"changelog_updated_at,omitempty"`
+				RequiresLogin     bool      `json:"requires_login,omitempty"`
+				ValidationError   string    `json:"validation_error,omitempty"`
+				LastWorkshopError string    `json:"last_workshop_error,omitempty"`
+			}
+			out := struct {
+				SteamCMD *steamcmd.Progress      `json:"steamcmd"`
+				Steam    state.SteamState        `json:"steam"`
+				Servers  map[string]serverStatus `json:"servers"`
+				Mods     map[string]modStatus    `json:"mods"`
+			}{SteamCMD: progress, Steam: st.Steam, Servers: map[string]serverStatus{}, Mods: map[string]modStatus{}}
+			for id, mod := range st.Mods {
+				out.Mods[id] = modStatus{
+					Title:             mod.LastTitle,
+					FolderSlug:        mod.FolderSlug,
+					WorkshopUpdatedAt: mod.WorkshopUpdatedAt,
+					LocalUpdatedAt:    mod.LocalUpdatedAt,
+					FileSize:          mod.FileSize,
+					PreviewURL:        mod.PreviewURL,
+					Tags:              mod.Tags,
+					ChildIDs:          mod.ChildIDs,
+					Banned:            mod.Banned,
+					BanReason:         mod.BanReason,
+					Visibility:        mod.Visibility,
+					WorkshopRevision:  mod.WorkshopRevision,
+					Changelog:         mod.Changelog,
+					ChangelogVersion:  mod.ChangelogUpdatedAt,
+					RequiresLogin:     mod.RequiresLogin,
+					ValidationError:   mod.ValidationError,
+					LastWorkshopError: mod.LastWorkshopError,
+				}
+			}
+			for id, srv := range st.Servers {
+				out.Servers[id] = serverStatus{
+					Stage:              srv.Stage,
+					NeedsModUpdate:     srv.NeedsModUpdate,
+					NeedsShutdown:      srv.NeedsShutdown,
+					ShutdownDeadlineAt: srv.ShutdownDeadlineAt,
+					LastError:          srv.LastError,
+					LastErrorStage:     srv.LastErrorStage,
+					LastErrorAt:        srv.LastErrorAt,
+					LastSuccessSyncAt:  srv.LastSuccessSyncAt,
+				}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "config.json", "path to config.json")
+	return cmd
+}
+
+func newHistoryCmd() *cobra.Command {
+	var configPath string
+	var serverID string
+
+	cmd := &cobra.Command{
+		Use:   "history --config <path> --server <id>",
+		Short: "Show recorded modlist changes of a server, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if serverID == "" {
+				return fmt.Errorf("--server is required")
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if !slices.ContainsFunc(cfg.Servers, func(s config.ServerConfig) bool { return s.ID == serverID }) {
+				return fmt.Errorf("unknown server %q", serverID)
+			}
+			history, err := modlist.ReadHistory(cfg.Paths.LocalCacheRoot, serverID)
+			if err != nil {
+				return fmt.Errorf("read modlist history for server %q: %w", serverID, err)
+			}
+			if history == nil {
+				history = []modlist.HistoryEntry{}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(history)
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "config.json", "path to config.json")
+	cmd.Flags().StringVar(&serverID, "server", "", "ID of the server whose modlist history to show")
+	return cmd
+}
+
 func newPrintSampleConfigCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "print-sample-config",
@@ -4,11 +4,59 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 )
 
 const defaultWorkshopGameID = 221100
 
+// defaultDeepVerifyHours applies only when sync.deep_verify_hours is omitted;
+// an explicit 0 disables deep verify.
+const defaultDeepVerifyHours = 24
+
+// DefaultSteamCMDBootstrapURL is Valve's Linux SteamCMD installer tarball.
+const DefaultSteamCMDBootstrapURL = "https://steamcdn-a.akamaihd.net/client/installer/steamcmd_linux.tar.gz"
+
+// DefaultChangelogBaseURL is the Steam Community Workshop changelog page.
+const DefaultChangelogBaseURL = "https://steamcommunity.com/sharedfiles/filedetails/changelog"
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+const (
+	CountdownPolicyRestart = "restart"
+	CountdownPolicyExtend  = "extend"
+	CountdownPolicyKeep    = "keep_deadline"
+)
+
+const (
+	CompareModeSizeMTime = "size_mtime"
+	CompareModeChecksum  = "checksum"
+)
+
+const (
+	RemoteListingManifest = "manifest"
+	RemoteListingWalk     = "walk"
+)
+
+const (
+	WorkshopBackendRemoteStorage        = "remote_storage"
+	WorkshopBackendPublishedFileService = "published_file_service"
+)
+
+const (
+	AccountStrategyFailover   = "failover"
+	AccountStrategyRoundRobin = "round_robin"
+)
+
+const (
+	MirrorStrategyCopy     = "copy"
+	MirrorStrategyHardlink = "hardlink"
+	MirrorStrategyDelta    = "delta"
+)
+
 type Config struct {
 	Version             int               `json:"version"`
 	PollIntervalSeconds int               `json:"poll_interval_seconds,omitempty"` // backward-compatible optional field.
@@ -18,6 +66,8 @@ type Config struct {
 	Shutdown            ShutdownConfig    `json:"shutdown"`
 	Concurrency         ConcurrencyConfig `json:"concurrency"`
 	Servers             []ServerConfig    `json:"servers"`
+	Sync                SyncConfig        `json:"sync"`
+	GC                  GCConfig          `json:"gc"`
 	StatePath           string            `json:"state_path,omitempty"` // backward-compatible optional field.
 	Mods                []ModConfig       `json:"mods,omitempty"`       // backward-compatible optional field.
 	RCON                LegacyRCONConfig  `json:"rcon,omitempty"`
@@ -29,33 +79,85 @@ type PathsConfig struct {
 	LocalCacheRoot              string `json:"local_cache_root"`
 	SteamcmdPath                string `json:"steamcmd_path"`
 	SteamcmdWorkshopContentRoot string `json:"steamcmd_workshop_content_root"`
+	ModlistAuditLog             string `json:"modlist_audit_log,omitempty"`
 }
 
 type SteamConfig struct {
-	APIKey                     string `json:"api_key,omitempty"`
-	Login                      string `json:"login"`
-	Password                   string `json:"password"`
-	WorkshopGameID             int    `json:"workshop_game_id"`
-	WebAPIKey                  string `json:"web_api_key,omitempty"`
-	WorkshopHTTPTimeoutSeconds int    `json:"workshop_http_timeout_seconds"`
-	WorkshopMaxRetries         int    `json:"workshop_max_retries"`
-	WorkshopBackoffMillis      int    `json:"workshop_backoff_millis"`
-	SteamCMDRetriesPerMod      int    `json:"steamcmd_retries_per_mod"`
-	SteamCMDBackoffMillis      int    `json:"steamcmd_backoff_millis"`
+	APIKey                         string                  `json:"api_key,omitempty"`
+	Login                          string                  `json:"login"`
+	Password                       string                  `json:"password"`
+	WorkshopGameID                 int                     `json:"workshop_game_id"`
+	WebAPIKey                      string                  `json:"web_api_key,omitempty"`
+	WorkshopHTTPTimeoutSeconds     int                     `json:"workshop_http_timeout_seconds"`
+	WorkshopMaxRetries             int                     `json:"workshop_max_retries"`
+	WorkshopBackoffMillis          int                     `json:"workshop_backoff_millis"`
+	WorkshopBackend                string                  `json:"workshop_backend"`
+	WorkshopRequestsPerMinute      int                     `json:"workshop_requests_per_minute"`
+	WorkshopBreakerThreshold       int                     `json:"workshop_breaker_threshold"`
+	WorkshopBreakerCooldownSeconds int                     `json:"workshop_breaker_cooldown_seconds"`
+	SteamCMDRetriesPerMod          int                     `json:"steamcmd_retries_per_mod"`
+	SteamCMDBackoffMillis          int                     `json:"steamcmd_backoff_millis"`
+	SteamCMDLogsPerMod             int                     `json:"steamcmd_logs_per_mod"`
+	SteamCMDTimeoutSeconds         int                     `json:"steamcmd_timeout_seconds"`
+	SteamCMDIdleTimeoutSeconds     int                     `json:"steamcmd_idle_timeout_seconds"`
+	MirrorStrategy                 string                  `json:"mirror_strategy"`
+	UnsignedMods                   []string                `json:"unsigned_mods,omitempty"`
+	Bootstrap                      SteamCMDBootstrapConfig `json:"steamcmd_bootstrap"`
+	Changelog                      ChangelogConfig         `json:"changelog"`
+	Anonymous                      bool                    `json:"anonymous,omitempty"`
+	Accounts                       []SteamAccountConfig    `json:"accounts,omitempty"`
+	AccountStrategy                string                  `json:"account_strategy"`
+	AccountCooldownMinutes         int                     `json:"account_cooldown_minutes"`
+}
+
+// SteamAccountConfig is one account of the SteamCMD account pool. Each pool
+// account runs SteamCMD with its own home directory, so its cached
+// credentials are kept apart from the other accounts'.
+type SteamAccountConfig struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// SteamCMDBootstrapConfig lets the daemon install SteamCMD into the directory
+// of paths.steamcmd_path when it is missing.
+type SteamCMDBootstrapConfig struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+}
+
+// ChangelogConfig enables fetching the Workshop changelog entry of updated
+// mods from base_url + "/<workshop id>".
+type ChangelogConfig struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	BaseURL string `json:"base_url"`
 }
 
 type IntervalsConfig struct {
 	ModlistPollSeconds  int `json:"modlist_poll_seconds"`
 	WorkshopPollSeconds int `json:"workshop_poll_seconds"`
-	RconTickSeconds     int `json:"rcon_tick_seconds"`
-	StateFlushSeconds   int `json:"state_flush_seconds"`
+	// WorkshopPollMinSeconds and WorkshopPollMaxSeconds bound the per-mod
+	// poll interval for recently updated and stale mods.
+	WorkshopPollMinSeconds int `json:"workshop_poll_min_seconds"`
+	WorkshopPollMaxSeconds int `json:"workshop_poll_max_seconds"`
+	RconTickSeconds        int `json:"rcon_tick_seconds"`
+	StateFlushSeconds      int `json:"state_flush_seconds"`
+	SSHKeepaliveSeconds    int `json:"ssh_keepalive_seconds"`
+	SSHIdleCloseSeconds    int `json:"ssh_idle_close_seconds"`
 }
 
 type ShutdownConfig struct {
-	GracePeriodSeconds   int    `json:"grace_period_seconds"`
-	AnnounceEverySeconds int    `json:"announce_every_seconds"`
-	MessageTemplate      string `json:"message_template"`
-	FinalMessage         string `json:"final_message"`
+	GracePeriodSeconds    int    `json:"grace_period_seconds"`
+	AnnounceEverySeconds  int    `json:"announce_every_seconds"`
+	MessageTemplate       string `json:"message_template"`
+	FinalMessage          string `json:"final_message"`
+	CountdownUpdatePolicy string `json:"countdown_update_policy"`
+	ExtendBySeconds       int    `json:"extend_by_seconds"`
+	MaxDeferSeconds       int    `json:"max_defer_seconds"`
+	RestartedMessage      string `json:"restarted_message"`
+	ExtendedMessage       string `json:"extended_message"`
+	MergedMessage         string `json:"merged_message"`
+	ChangelogMaxChars     int    `json:"changelog_max_chars"`
 }
 
 type ConcurrencyConfig struct {
@@ -66,6 +168,50 @@ type ConcurrencyConfig struct {
 	WorkshopBatchSize                int `json:"workshop_batch_size"`
 }
 
+type SyncConfig struct {
+	CompareMode                  string                     `json:"compare_mode"`
+	RemoteListing                string                     `json:"remote_listing"`
+	DeepVerifyHours              int                        `json:"deep_verify_hours"`
+	FileWorkersPerMod            int                        `json:"file_workers_per_mod"`
+	SFTPSessionsPerServer        int                        `json:"sftp_sessions_per_server"`
+	MaxConcurrentRequestsPerFile int                        `json:"max_concurrent_requests_per_file,omitempty"`
+	UseConcurrentWrites          bool                       `json:"use_concurrent_writes,omitempty"`
+	Bandwidth                    BandwidthConfig            `json:"bandwidth,omitempty"`
+	DeleteOrphans                bool                       `json:"delete_orphans,omitempty"`
+	ModRules                     map[string]SyncRulesConfig `json:"mod_rules,omitempty"`
+}
+
+// BandwidthConfig caps upload throughput in bytes per second; 0 means
+// unlimited. The first quiet_hours window containing the current local time
+// overrides max_bytes_per_second.
+type BandwidthConfig struct {
+	MaxBytesPerSecond int64              `json:"max_bytes_per_second,omitempty"`
+	QuietHours        []QuietHoursConfig `json:"quiet_hours,omitempty"`
+}
+
+// QuietHoursConfig is a daily window in "HH:MM" local time. End before Start
+// wraps past midnight.
+type QuietHoursConfig struct {
+	Start             string `json:"start"`
+	End               string `json:"end"`
+	MaxBytesPerSecond int64  `json:"max_bytes_per_second"`
+}
+
+// GCConfig controls cleanup of local mod copies that no server references
+// any more, staging leftovers and, optionally, SteamCMD's workshop copies.
+type GCConfig struct {
+	Enabled              bool `json:"enabled,omitempty"`
+	IntervalHours        int  `json:"interval_hours"`
+	RetentionHours       int  `json:"retention_hours"`
+	PruneSteamCMDContent bool `json:"prune_steamcmd_content,omitempty"`
+}
+
+type SyncRulesConfig struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	Protect []string `json:"protect,omitempty"`
+}
+
 type ServerConfig struct {
 	ID   string           `json:"id"`
 	Name string           `json:"name"`
@@ -74,16 +220,19 @@ type ServerConfig struct {
 }
 
 type ServerSFTPConfig struct {
-	Host                    string         `json:"host"`
-	Port                    int            `json:"port"`
-	User                    string         `json:"user"`
-	Auth                    SFTPAuthConfig `json:"auth"`
-	RemoteModlistPath       string         `json:"remote_modlist_path"`
-	RemoteModsRoot          string         `json:"remote_mods_root"`
-	ConnectTimeoutSeconds   int            `json:"connect_timeout_seconds"`
-	OperationTimeoutSeconds int            `json:"operation_timeout_seconds"`
-	MaxRetries              int            `json:"max_retries"`
-	RetryBackoffMillis      int            `json:"retry_backoff_millis"`
+	Host                    string          `json:"host"`
+	Port                    int             `json:"port"`
+	User                    string          `json:"user"`
+	Auth                    SFTPAuthConfig  `json:"auth"`
+	RemoteModlistPath       string          `json:"remote_modlist_path"`
+	RemoteModsRoot          string          `json:"remote_mods_root"`
+	ConnectTimeoutSeconds   int             `json:"connect_timeout_seconds"`
+	OperationTimeoutSeconds int             `json:"operation_timeout_seconds"`
+	MaxRetries              int             `json:"max_retries"`
+	RetryBackoffMillis      int             `json:"retry_backoff_millis"`
+	Rules                   SyncRulesConfig `json:"rules,omitempty"`
+	AllowSSHExec            bool            `json:"allow_ssh_exec,omitempty"`
+	Bandwidth               BandwidthConfig `json:"bandwidth,omitempty"`
 }
 
 type SFTPAuthConfig struct {
@@ -124,7 +273,7 @@ func Load(path string) (Config, error) {
 	if err != nil {
 		return Config{}, fmt.Errorf("read config: %w", err)
 	}
-	var cfg Config
+	cfg := Config{Sync: SyncConfig{DeepVerifyHours: defaultDeepVerifyHours}}
 	if err := json.Unmarshal(b, &cfg); err != nil {
 		return Config{}, fmt.Errorf("parse config: %w", err)
 	}
@@ -139,6 +288,9 @@ func (c *Config) applyDefaults() {
 	if c.StatePath == "" {
 		c.StatePath = "state.json"
 	}
+	if c.Paths.ModlistAuditLog == "" && c.Paths.LocalCacheRoot != "" {
+		c.Paths.ModlistAuditLog = filepath.Join(c.Paths.LocalCacheRoot, "audit", "modlist_changes.jsonl")
+	}
 	if c.Version == 0 {
 		c.Version = 1
 	}
@@ -155,12 +307,90 @@ func (c *Config) applyDefaults() {
 	if c.Intervals.WorkshopPollSeconds <= 0 {
 		c.Intervals.WorkshopPollSeconds = 300
 	}
+	if c.Intervals.WorkshopPollMinSeconds <= 0 {
+		c.Intervals.WorkshopPollMinSeconds = max(c.Intervals.WorkshopPollSeconds/2, 1)
+	}
+	if c.Intervals.WorkshopPollMaxSeconds <= 0 {
+		c.Intervals.WorkshopPollMaxSeconds = c.Intervals.WorkshopPollSeconds * 4
+	}
 	if c.Intervals.RconTickSeconds <= 0 {
 		c.Intervals.RconTickSeconds = 5
 	}
 	if c.Intervals.StateFlushSeconds <= 0 {
 		c.Intervals.StateFlushSeconds = 15
 	}
+	if c.Intervals.SSHKeepaliveSeconds <= 0 {
+		c.Intervals.SSHKeepaliveSeconds = 30
+	}
+	if c.Intervals.SSHIdleCloseSeconds <= 0 {
+		c.Intervals.SSHIdleCloseSeconds = 300
+	}
+	if c.Shutdown.CountdownUpdatePolicy == "" {
+		c.Shutdown.CountdownUpdatePolicy = CountdownPolicyRestart
+	}
+	if c.Shutdown.ExtendBySeconds <= 0 {
+		c.Shutdown.ExtendBySeconds = c.Shutdown.GracePeriodSeconds
+	}
+	if c.Shutdown.MaxDeferSeconds <= 0 {
+		c.Shutdown.MaxDeferSeconds = 1800
+	}
+	if c.Shutdown.RestartedMessage == "" {
+		c.Shutdown.RestartedMessage = "Another mod update arrived, restart countdown reset to {minutes} minute(s)"
+	}
+	if c.Shutdown.ExtendedMessage == "" {
+		c.Shutdown.ExtendedMessage = "Another mod update arrived, restart postponed to {minutes} minute(s)"
+	}
+	if c.Shutdown.MergedMessage == "" {
+		c.Shutdown.MergedMessage = "Another mod update was included, restart still in {minutes} minute(s)"
+	}
+	if c.Shutdown.ChangelogMaxChars <= 0 {
+		c.Shutdown.ChangelogMaxChars = 120
+	}
+	if c.Steam.SteamCMDLogsPerMod <= 0 {
+		c.Steam.SteamCMDLogsPerMod = 10
+	}
+	if c.Steam.SteamCMDTimeoutSeconds <= 0 {
+		c.Steam.SteamCMDTimeoutSeconds = 3600
+	}
+	if c.Steam.SteamCMDIdleTimeoutSeconds <= 0 {
+		c.Steam.SteamCMDIdleTimeoutSeconds = 600
+	}
+	if c.Steam.MirrorStrategy == "" {
+		c.Steam.MirrorStrategy = MirrorStrategyCopy
+	}
+	if c.Steam.WorkshopBackend == "" {
+		c.Steam.WorkshopBackend = WorkshopBackendRemoteStorage
+	}
+	if c.Steam.AccountStrategy == "" {
+		c.Steam.AccountStrategy = AccountStrategyFailover
+	}
+	if c.Steam.AccountCooldownMinutes <= 0 {
+		c.Steam.AccountCooldownMinutes = 15
+	}
+	if c.Steam.Changelog.BaseURL == "" {
+		c.Steam.Changelog.BaseURL = DefaultChangelogBaseURL
+	}
+	if c.Steam.Bootstrap.URL == "" {
+		c.Steam.Bootstrap.URL = DefaultSteamCMDBootstrapURL
+	}
+	if c.Sync.CompareMode == "" {
+		c.Sync.CompareMode = CompareModeSizeMTime
+	}
+	if c.Sync.RemoteListing == "" {
+		c.Sync.RemoteListing = RemoteListingManifest
+	}
+	if c.GC.IntervalHours <= 0 {
+		c.GC.IntervalHours = 24
+	}
+	if c.GC.RetentionHours <= 0 {
+		c.GC.RetentionHours = 168
+	}
+	if c.Sync.FileWorkersPerMod <= 0 {
+		c.Sync.FileWorkersPerMod = 1
+	}
+	if c.Sync.SFTPSessionsPerServer <= 0 {
+		c.Sync.SFTPSessionsPerServer = 1
+	}
 	for i := range c.Servers {
 		if c.Servers[i].SFTP.RemoteModlistPath == "" {
 			c.Servers[i].SFTP.RemoteModlistPath = "/modlist.html"
@@ -187,6 +417,15 @@ func (c *Config) applyDefaults() {
 	if c.Steam.WorkshopBackoffMillis <= 0 {
 		c.Steam.WorkshopBackoffMillis = 500
 	}
+	if c.Steam.WorkshopRequestsPerMinute <= 0 {
+		c.Steam.WorkshopRequestsPerMinute = 60
+	}
+	if c.Steam.WorkshopBreakerThreshold <= 0 {
+		c.Steam.WorkshopBreakerThreshold = 5
+	}
+	if c.Steam.WorkshopBreakerCooldownSeconds <= 0 {
+		c.Steam.WorkshopBreakerCooldownSeconds = 300
+	}
 	if c.Steam.SteamCMDRetriesPerMod <= 0 {
 		c.Steam.SteamCMDRetriesPerMod = 3
 	}
@@ -199,18 +438,59 @@ func (c Config) Validate() error {
 	if c.Paths.LocalModsRoot == "" || c.Paths.LocalCacheRoot == "" || c.Paths.SteamcmdPath == "" || c.Paths.SteamcmdWorkshopContentRoot == "" {
 		return fmt.Errorf("paths.local_mods_root, paths.local_cache_root, paths.steamcmd_path, and paths.steamcmd_workshop_content_root are required")
 	}
-	if c.Steam.Login == "" || c.Steam.Password == "" {
-		return fmt.Errorf("steam.login and steam.password are required")
+	if err := validateSteamAccounts(c.Steam, c.Paths); err != nil {
+		return err
 	}
 	if c.Shutdown.GracePeriodSeconds <= 0 || c.Shutdown.AnnounceEverySeconds <= 0 || c.Shutdown.MessageTemplate == "" || c.Shutdown.FinalMessage == "" {
 		return fmt.Errorf("shutdown.grace_period_seconds, shutdown.announce_every_seconds, shutdown.message_template, and shutdown.final_message are required")
 	}
+	switch c.Shutdown.CountdownUpdatePolicy {
+	case CountdownPolicyRestart, CountdownPolicyExtend, CountdownPolicyKeep:
+	default:
+		return fmt.Errorf("shutdown.countdown_update_policy must be one of: %s, %s, %s", CountdownPolicyRestart, CountdownPolicyExtend, CountdownPolicyKeep)
+	}
 	if c.Concurrency.ModlistPollParallelism <= 0 || c.Concurrency.SFTPSyncParallelismServers <= 0 || c.Concurrency.SFTPSyncParallelismModsPerServer <= 0 || c.Concurrency.WorkshopParallelism <= 0 || c.Concurrency.WorkshopBatchSize <= 0 {
 		return fmt.Errorf("all concurrency fields must be greater than zero")
 	}
 	if len(c.Servers) == 0 {
 		return fmt.Errorf("at least one server is required")
 	}
+	if c.Intervals.WorkshopPollMinSeconds > c.Intervals.WorkshopPollSeconds || c.Intervals.WorkshopPollMaxSeconds < c.Intervals.WorkshopPollSeconds {
+		return fmt.Errorf("intervals.workshop_poll_min_seconds <= intervals.workshop_poll_seconds <= intervals.workshop_poll_max_seconds is required")
+	}
+	switch c.Steam.WorkshopBackend {
+	case "", WorkshopBackendRemoteStorage:
+	case WorkshopBackendPublishedFileService:
+		if c.Steam.WebAPIKey == "" {
+			return fmt.Errorf("steam.web_api_key is required for steam.workshop_backend %s", WorkshopBackendPublishedFileService)
+		}
+	default:
+		return fmt.Errorf("steam.workshop_backend must be one of: %s, %s", WorkshopBackendRemoteStorage, WorkshopBackendPublishedFileService)
+	}
+	switch c.Steam.MirrorStrategy {
+	case "", MirrorStrategyCopy, MirrorStrategyHardlink, MirrorStrategyDelta:
+	default:
+		return fmt.Errorf("steam.mirror_strategy must be one of: %s, %s, %s", MirrorStrategyCopy, MirrorStrategyHardlink, MirrorStrategyDelta)
+	}
+	if c.Steam.Bootstrap.Enabled && !sha256Pattern.MatchString(c.Steam.Bootstrap.SHA256) {
+		return fmt.Errorf("steam.steamcmd_bootstrap.sha256 must be a hex SHA-256 digest when bootstrap is enabled")
+	}
+	switch c.Sync.CompareMode {
+	case "", CompareModeSizeMTime, CompareModeChecksum:
+	default:
+		return fmt.Errorf("sync.compare_mode must be one of: %s, %s", CompareModeSizeMTime, CompareModeChecksum)
+	}
+	if c.Sync.DeepVerifyHours < 0 {
+		return fmt.Errorf("sync.deep_verify_hours must not be negative")
+	}
+	if c.Sync.MaxConcurrentRequestsPerFile < 0 {
+		return fmt.Errorf("sync.max_concurrent_requests_per_file must not be negative")
+	}
+	switch c.Sync.RemoteListing {
+	case "", RemoteListingManifest, RemoteListingWalk:
+	default:
+		return fmt.Errorf("sync.remote_listing must be one of: %s, %s", RemoteListingManifest, RemoteListingWalk)
+	}
 	seen := make(map[string]struct{}, len(c.Servers))
 	for i := range c.Servers {
 		srv := c.Servers[i]
@@ -230,10 +510,109 @@ func (c Config) Validate() error {
 		if srv.RCON.Host == "" || srv.RCON.Port <= 0 || srv.RCON.Password == "" {
 			return fmt.Errorf("servers[%d].rcon host/port/password are required", i)
 		}
+		if err := validateSyncRules(fmt.Sprintf("servers[%d].sftp.rules", i), srv.SFTP.Rules); err != nil {
+			return err
+		}
+		if err := validateBandwidth(fmt.Sprintf("servers[%d].sftp.bandwidth", i), srv.SFTP.Bandwidth); err != nil {
+			return err
+		}
+	}
+	if err := validateBandwidth("sync.bandwidth", c.Sync.Bandwidth); err != nil {
+		return err
+	}
+	for modID, rules := range c.Sync.ModRules {
+		if err := validateSyncRules(fmt.Sprintf("sync.mod_rules[%s]", modID), rules); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func validateSyncRules(field string, rules SyncRulesConfig) error {
+	groups := []struct {
+		name     string
+		patterns []string
+	}{{"include", rules.Include}, {"exclude", rules.Exclude}, {"protect", rules.Protect}}
+	for _, group := range groups {
+		for _, pattern := range group.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s.%s pattern %q is invalid: %w", field, group.name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateBandwidth(field string, bw BandwidthConfig) error {
+	if bw.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("%s.max_bytes_per_second must not be negative", field)
+	}
+	for i, window := range bw.QuietHours {
+		if _, err := ParseClock(window.Start); err != nil {
+			return fmt.Errorf("%s.quiet_hours[%d].start: %w", field, i, err)
+		}
+		if _, err := ParseClock(window.End); err != nil {
+			return fmt.Errorf("%s.quiet_hours[%d].end: %w", field, i, err)
+		}
+		if window.MaxBytesPerSecond < 0 {
+			return fmt.Errorf("%s.quiet_hours[%d].max_bytes_per_second must not be negative", field, i)
+		}
+	}
+	return nil
+}
+
+// ParseClock parses "HH:MM" into minutes since midnight.
+func ParseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateSteamAccounts(steam SteamConfig, paths PathsConfig) error {
+	if (steam.Login == "") != (steam.Password == "") {
+		return fmt.Errorf("steam.login and steam.password must be set together")
+	}
+	if steam.Login == "" && len(steam.Accounts) == 0 && !steam.Anonymous {
+		return fmt.Errorf("steam.login and steam.password, steam.accounts, or steam.anonymous are required")
+	}
+	seen := map[string]struct{}{steam.Login: {}}
+	for i, acct := range steam.Accounts {
+		if acct.Login == "" || acct.Password == "" {
+			return fmt.Errorf("steam.accounts[%d].login and password are required", i)
+		}
+		if strings.EqualFold(acct.Login, "anonymous") {
+			return fmt.Errorf("steam.accounts[%d]: use steam.anonymous for anonymous login", i)
+		}
+		if _, ok := seen[acct.Login]; ok {
+			return fmt.Errorf("steam.accounts[%d].login %q is duplicated", i, acct.Login)
+		}
+		seen[acct.Login] = struct{}{}
+	}
+	if len(steam.Accounts) > 0 && WorkshopInstallDir(paths.SteamcmdWorkshopContentRoot) == "" {
+		return fmt.Errorf("steam.accounts requires paths.steamcmd_workshop_content_root to end in steamapps/workshop/content")
+	}
+	switch steam.AccountStrategy {
+	case "", AccountStrategyFailover, AccountStrategyRoundRobin:
+	default:
+		return fmt.Errorf("steam.account_strategy must be one of: %s, %s", AccountStrategyFailover, AccountStrategyRoundRobin)
+	}
+	return nil
+}
+
+// WorkshopInstallDir returns the directory SteamCMD must be pointed at with
+// +force_install_dir so workshop items land in contentRoot, or "" if
+// contentRoot is not <dir>/steamapps/workshop/content.
+func WorkshopInstallDir(contentRoot string) string {
+	clean := filepath.Clean(contentRoot)
+	suffix := filepath.Join("steamapps", "workshop", "content")
+	if !strings.HasSuffix(clean, string(filepath.Separator)+suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(clean, string(filepath.Separator)+suffix)
+}
+
 func validateSFTPAuth(i int, auth SFTPAuthConfig) error {
 	switch auth.Type {
 	case "password":
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -28,6 +29,83 @@ func TestLoadParsesAndDefaults(t *testing.T) {
 	if cfg.Steam.WorkshopGameID != defaultWorkshopGameID {
 		t.Fatalf("expected default workshop game id, got %d", cfg.Steam.WorkshopGameID)
 	}
+	if cfg.Shutdown.CountdownUpdatePolicy != CountdownPolicyRestart || cfg.Shutdown.ExtendBySeconds != 300 {
+		t.Fatalf("unexpected countdown update defaults: %#v", cfg.Shutdown)
+	}
+	if cfg.Steam.MirrorStrategy != MirrorStrategyCopy {
+		t.Fatalf("expected default mirror strategy copy, got %q", cfg.Steam.MirrorStrategy)
+	}
+	if cfg.Sync.DeepVerifyHours != defaultDeepVerifyHours {
+		t.Fatalf("expected default deep verify hours, got %d", cfg.Sync.DeepVerifyHours)
+	}
+}
+
+func TestDeepVerifyHoursZeroDisables(t *testing.T) {
+	cfg := Sample()
+	cfg.Sync.DeepVerifyHours = 0
+	cfg.applyDefaults()
+	if cfg.Sync.DeepVerifyHours != 0 {
+		t.Fatalf("expected explicit 0 to be kept, got %d", cfg.Sync.DeepVerifyHours)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected 0 to be valid, got %v", err)
+	}
+	cfg.Sync.DeepVerifyHours = -1
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "deep_verify_hours") {
+		t.Fatalf("expected negative deep_verify_hours to be rejected, got %v", err)
+	}
+}
+
+func TestValidateMirrorStrategy(t *testing.T) {
+	cfg := Sample()
+	cfg.Steam.MirrorStrategy = "reflink"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected invalid mirror strategy validation error")
+	}
+	cfg.Steam.MirrorStrategy = MirrorStrategyDelta
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestValidateSteamCMDBootstrapChecksum(t *testing.T) {
+	cfg := Sample()
+	cfg.Steam.Bootstrap.Enabled = true
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected missing bootstrap checksum validation error")
+	}
+	cfg.Steam.Bootstrap.SHA256 = strings.Repeat("ab", 32)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestValidateSteamAccounts(t *testing.T) {
+	cfg := Sample()
+	cfg.Steam.Login, cfg.Steam.Password = "", ""
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected missing steam credentials validation error")
+	}
+	cfg.Steam.Anonymous = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("anonymous only: unexpected validation error: %v", err)
+	}
+	cfg.Steam.Accounts = []SteamAccountConfig{{Login: "a", Password: "x"}}
+	cfg.Paths.SteamcmdWorkshopContentRoot = "/srv/workshop"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected content root validation error for account pool")
+	}
+	cfg.Paths.SteamcmdWorkshopContentRoot = "/home/steam/Steam/steamapps/workshop/content"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := WorkshopInstallDir(cfg.Paths.SteamcmdWorkshopContentRoot); got != "/home/steam/Steam" {
+		t.Fatalf("workshop install dir = %q", got)
+	}
+	cfg.Steam.Accounts = append(cfg.Steam.Accounts, SteamAccountConfig{Login: "a", Password: "y"})
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected duplicate account validation error")
+	}
 }
 
 func TestValidateUniqueServerID(t *testing.T) {
@@ -37,3 +115,45 @@ func TestValidateUniqueServerID(t *testing.T) {
 		t.Fatal("expected duplicate server id validation error")
 	}
 }
+
+func TestValidateBandwidthQuietHours(t *testing.T) {
+	cfg := Sample()
+	cfg.Servers[0].SFTP.Bandwidth = BandwidthConfig{QuietHours: []QuietHoursConfig{{Start: "25:00", End: "06:00"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected invalid quiet hours validation error")
+	}
+	cfg.Servers[0].SFTP.Bandwidth.QuietHours[0].Start = "23:00"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestValidateWorkshopBackend(t *testing.T) {
+	cfg := Sample()
+	cfg.Steam.WorkshopBackend = WorkshopBackendPublishedFileService
+	cfg.Steam.WebAPIKey = ""
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected missing web api key validation error")
+	}
+	cfg.Steam.WebAPIKey = "key"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	cfg.Steam.WorkshopBackend = "scraper"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected invalid workshop backend validation error")
+	}
+}
+
+func TestWorkshopPollBounds(t *testing.T) {
+	cfg := Config{Intervals: IntervalsConfig{WorkshopPollSeconds: 600}}
+	cfg.applyDefaults()
+	if cfg.Intervals.WorkshopPollMinSeconds != 300 || cfg.Intervals.WorkshopPollMaxSeconds != 2400 {
+		t.Fatalf("unexpected poll bounds: %+v", cfg.Intervals)
+	}
+	sample := Sample()
+	sample.Intervals.WorkshopPollMinSeconds = sample.Intervals.WorkshopPollSeconds + 1
+	if err := sample.Validate(); err == nil {
+		t.Fatal("expected poll bounds validation error")
+	}
+}
@@ -10,27 +10,50 @@ func Sample() Config {
 			SteamcmdWorkshopContentRoot: "/home/steam/.steam/steam/steamapps/workshop/content",
 		},
 		Steam: SteamConfig{
-			Login:                      "steam_user",
-			Password:                   "steam_password",
-			WorkshopGameID:             defaultWorkshopGameID,
-			WebAPIKey:                  "",
-			WorkshopHTTPTimeoutSeconds: 20,
-			WorkshopMaxRetries:         3,
-			WorkshopBackoffMillis:      500,
-			SteamCMDRetriesPerMod:      3,
-			SteamCMDBackoffMillis:      1000,
+			Login:                          "steam_user",
+			Password:                       "steam_password",
+			WorkshopGameID:                 defaultWorkshopGameID,
+			WebAPIKey:                      "",
+			WorkshopHTTPTimeoutSeconds:     20,
+			WorkshopMaxRetries:             3,
+			WorkshopBackoffMillis:          500,
+			WorkshopBackend:                WorkshopBackendRemoteStorage,
+			WorkshopRequestsPerMinute:      60,
+			WorkshopBreakerThreshold:       5,
+			WorkshopBreakerCooldownSeconds: 300,
+			SteamCMDRetriesPerMod:          3,
+			SteamCMDBackoffMillis:          1000,
+			SteamCMDLogsPerMod:             10,
+			SteamCMDTimeoutSeconds:         3600,
+			SteamCMDIdleTimeoutSeconds:     600,
+			MirrorStrategy:                 MirrorStrategyCopy,
+			Bootstrap:                      SteamCMDBootstrapConfig{URL: DefaultSteamCMDBootstrapURL},
+			Changelog:                      ChangelogConfig{BaseURL: DefaultChangelogBaseURL},
+			AccountStrategy:                AccountStrategyFailover,
+			AccountCooldownMinutes:         15,
 		},
 		Intervals: IntervalsConfig{
-			ModlistPollSeconds:  60,
-			WorkshopPollSeconds: 300,
-			RconTickSeconds:     5,
-			StateFlushSeconds:   15,
+			ModlistPollSeconds:     60,
+			WorkshopPollSeconds:    300,
+			WorkshopPollMinSeconds: 150,
+			WorkshopPollMaxSeconds: 1200,
+			RconTickSeconds:        5,
+			StateFlushSeconds:      15,
+			SSHKeepaliveSeconds:    30,
+			SSHIdleCloseSeconds:    300,
 		},
 		Shutdown: ShutdownConfig{
-			GracePeriodSeconds:   300,
-			AnnounceEverySeconds: 60,
-			MessageTemplate:      "Server restart in {minutes} minute(s)",
-			FinalMessage:         "Server restarting now",
+			GracePeriodSeconds:    300,
+			AnnounceEverySeconds:  60,
+			MessageTemplate:       "Server restart in {minutes} minute(s)",
+			FinalMessage:          "Server restarting now",
+			CountdownUpdatePolicy: CountdownPolicyRestart,
+			ExtendBySeconds:       300,
+			MaxDeferSeconds:       1800,
+			RestartedMessage:      "Another mod update arrived, restart countdown reset to {minutes} minute(s)",
+			ExtendedMessage:       "Another mod update arrived, restart postponed to {minutes} minute(s)",
+			MergedMessage:         "Another mod update was included, restart still in {minutes} minute(s)",
+			ChangelogMaxChars:     120,
 		},
 		Concurrency: ConcurrencyConfig{
 			ModlistPollParallelism:           4,
@@ -63,6 +86,17 @@ func Sample() Config {
 				Password: "rcon_password",
 			},
 		}},
+		Sync: SyncConfig{
+			CompareMode:           CompareModeSizeMTime,
+			RemoteListing:         RemoteListingManifest,
+			DeepVerifyHours:       24,
+			FileWorkersPerMod:     1,
+			SFTPSessionsPerServer: 1,
+		},
+		GC: GCConfig{
+			IntervalHours:  24,
+			RetentionHours: 168,
+		},
 		StatePath: "state.json",
 	}
 }
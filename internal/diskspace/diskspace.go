@@ -0,0 +1,71 @@
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupported is returned by Free on platforms without a free-space query.
+var ErrUnsupported = errors.New("disk space query not supported on this platform")
+
+// InsufficientSpaceError reports a preflight check that failed.
+type InsufficientSpaceError struct {
+	Path      string
+	Required  uint64
+	Available uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient disk space at %s: need %d bytes, %d available", e.Path, e.Required, e.Available)
+}
+
+// IsInsufficient reports whether err is or wraps an InsufficientSpaceError.
+func IsInsufficient(err error) bool {
+	var target *InsufficientSpaceError
+	return errors.As(err, &target)
+}
+
+// Check returns an InsufficientSpaceError when the filesystem holding p has
+// less than required bytes available. p does not have to exist yet; its
+// nearest existing parent is queried instead. Unsupported platforms pass.
+func Check(p string, required uint64) error {
+	if required == 0 {
+		return nil
+	}
+	dir, err := existingParent(p)
+	if err != nil {
+		return err
+	}
+	free, err := Free(dir)
+	if err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("query free space at %s: %w", dir, err)
+	}
+	if free < required {
+		return &InsufficientSpaceError{Path: p, Required: required, Available: free}
+	}
+	return nil
+}
+
+func existingParent(p string) (string, error) {
+	dir, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,28 @@
+package diskspace
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckUsesNearestExistingParent(t *testing.T) {
+	dir := t.TempDir()
+	if err := Check(filepath.Join(dir, "not", "yet", "created"), 1); err != nil {
+		t.Fatalf("expected check to pass on a missing path, got %v", err)
+	}
+}
+
+func TestCheckReportsInsufficientSpace(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Free(dir); err == ErrUnsupported {
+		t.Skip("free space query not supported")
+	}
+	err := Check(dir, 1<<62)
+	if !IsInsufficient(err) {
+		t.Fatalf("expected insufficient space error, got %v", err)
+	}
+	if !IsInsufficient(fmt.Errorf("wrapped: %w", err)) {
+		t.Fatal("expected wrapped error to be detected")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package diskspace
+
+func Free(dir string) (uint64, error) {
+	_ = dir
+	return 0, ErrUnsupported
+}
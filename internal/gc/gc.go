@@ -0,0 +1,223 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+// stagingMinAge keeps GC away from staging directories a mirror may still be
+// writing to.
+const stagingMinAge = time.Hour
+
+type Options struct {
+	DryRun bool
+}
+
+// Report lists what a GC pass removed (or would remove in a dry run).
+type Report struct {
+	RemovedMods      []string `json:"removed_mods"`
+	StagingRemoved   []string `json:"staging_removed"`
+	SteamCMDPruned   []string `json:"steamcmd_pruned"`
+	BytesReclaimed   int64    `json:"bytes_reclaimed"`
+	PendingRetention int      `json:"pending_retention"`
+	DryRun           bool     `json:"dry_run"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+type pass struct {
+	cfg             config.Config
+	dryRun          bool
+	referencedSlugs map[string]struct{}
+	report          *Report
+}
+
+// Run performs one GC pass and updates st. A mod that no server lists in
+// last_mod_ids starts a retention clock (unreferenced_since); once it has
+// expired the local copy, its hash cache and its state entry are removed so
+// the mod is downloaded again if it ever comes back.
+func Run(cfg config.Config, st *state.State, now time.Time, opts Options) (Report, error) {
+	report := Report{DryRun: opts.DryRun}
+	p := pass{cfg: cfg, dryRun: opts.DryRun, referencedSlugs: map[string]struct{}{}, report: &report}
+	referenced := map[string]struct{}{}
+	for _, srv := range st.Servers {
+		for _, id := range srv.LastModIDs {
+			referenced[id] = struct{}{}
+		}
+	}
+	for id := range referenced {
+		if slug := st.Mods[id].FolderSlug; slug != "" {
+			p.referencedSlugs[slug] = struct{}{}
+		}
+	}
+
+	retention := time.Duration(cfg.GC.RetentionHours) * time.Hour
+	ids := make([]string, 0, len(st.Mods))
+	for id := range st.Mods {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		mod := st.Mods[id]
+		if _, ok := referenced[id]; ok {
+			if mod.UnreferencedSince != nil && !opts.DryRun {
+				mod.UnreferencedSince = nil
+				st.Mods[id] = mod
+			}
+			continue
+		}
+		if mod.UnreferencedSince == nil {
+			if !opts.DryRun {
+				since := now.UTC()
+				mod.UnreferencedSince = &since
+				st.Mods[id] = mod
+			}
+			report.PendingRetention++
+			continue
+		}
+		if now.Sub(*mod.UnreferencedSince) < retention {
+			report.PendingRetention++
+			continue
+		}
+		if err := p.removeMod(id, mod); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("mod %s: %v", id, err))
+			continue
+		}
+		report.RemovedMods = append(report.RemovedMods, id)
+		if !opts.DryRun {
+			delete(st.Mods, id)
+		}
+	}
+
+	if err := p.cleanStaging(filepath.Join(cfg.Paths.LocalCacheRoot, "staging"), now); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("staging: %v", err))
+	}
+
+	if cfg.GC.PruneSteamCMDContent {
+		for id := range referenced {
+			mod, ok := st.Mods[id]
+			if !ok || mod.LocalUpdatedAt.IsZero() || !isDir(filepath.Join(cfg.Paths.LocalModsRoot, slugOrDefault(mod.FolderSlug, id))) {
+				continue
+			}
+			if err := p.pruneSteamCMD(id); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("steamcmd content %s: %v", id, err))
+			}
+		}
+	}
+	sort.Strings(report.SteamCMDPruned)
+
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("gc finished with %d errors: %s", len(report.Errors), strings.Join(report.Errors, "; "))
+	}
+	return report, nil
+}
+
+// removeMod deletes an expired mod's local copy and hash cache, unless a
+// referenced mod maps to the same folder.
+func (p pass) removeMod(id string, mod state.ModState) error {
+	slug := slugOrDefault(mod.FolderSlug, id)
+	if _, shared := p.referencedSlugs[slug]; !shared {
+		if err := p.remove(filepath.Join(p.cfg.Paths.LocalModsRoot, slug)); err != nil {
+			return err
+		}
+		if err := p.remove(filepath.Join(p.cfg.Paths.LocalCacheRoot, "hashes", slug+".json")); err != nil {
+			return err
+		}
+	}
+	if p.cfg.GC.PruneSteamCMDContent {
+		return p.pruneSteamCMD(id)
+	}
+	return nil
+}
+
+func (p pass) pruneSteamCMD(id string) error {
+	dir := filepath.Join(p.cfg.Paths.SteamcmdWorkshopContentRoot, fmt.Sprintf("%d", p.cfg.Steam.WorkshopGameID), id)
+	if !isDir(dir) {
+		return nil
+	}
+	if err := p.remove(dir); err != nil {
+		return err
+	}
+	p.report.SteamCMDPruned = append(p.report.SteamCMDPruned, id)
+	return nil
+}
+
+func (p pass) cleanStaging(root string, now time.Time) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) < stagingMinAge {
+			continue
+		}
+		if err := p.remove(filepath.Join(root, entry.Name())); err != nil {
+			return err
+		}
+		p.report.StagingRemoved = append(p.report.StagingRemoved, entry.Name())
+	}
+	return nil
+}
+
+// remove deletes target (file or tree) and adds its size to the report.
+func (p pass) remove(target string) error {
+	size, err := diskUsage(target)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !p.dryRun {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	p.report.BytesReclaimed += size
+	return nil
+}
+
+func diskUsage(p string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+func slugOrDefault(slug, id string) string {
+	if strings.TrimSpace(slug) == "" {
+		return "mod-" + id
+	}
+	return slug
+}
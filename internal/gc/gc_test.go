@@ -0,0 +1,195 @@
+package gc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+func gcFixture(t *testing.T) (config.Config, *state.State, time.Time) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := config.Config{
+		Paths: config.PathsConfig{
+			LocalModsRoot:               filepath.Join(root, "mods"),
+			LocalCacheRoot:              filepath.Join(root, "cache"),
+			SteamcmdWorkshopContentRoot: filepath.Join(root, "steamcmd"),
+		},
+		Steam: config.SteamConfig{WorkshopGameID: 221100},
+		GC:    config.GCConfig{RetentionHours: 24},
+	}
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	writeFile(t, filepath.Join(cfg.Paths.LocalModsRoot, "cf", "addons", "cf.pbo"), 100)
+	writeFile(t, filepath.Join(cfg.Paths.LocalModsRoot, "old", "addons", "old.pbo"), 250)
+	writeFile(t, filepath.Join(cfg.Paths.LocalCacheRoot, "hashes", "old.json"), 10)
+	writeFile(t, filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "1", "cf.pbo"), 100)
+	writeFile(t, filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "2", "old.pbo"), 250)
+	st := &state.State{
+		Mods: map[string]state.ModState{
+			"1": {FolderSlug: "cf", LocalUpdatedAt: now.Add(-time.Hour)},
+			"2": {FolderSlug: "old", LocalUpdatedAt: now.Add(-time.Hour)},
+		},
+		Servers: map[string]state.ServerState{
+			"a": {LastModIDs: []string{"1"}},
+		},
+	}
+	return cfg, st, now
+}
+
+func writeFile(t *testing.T, p string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func TestRunRemovesUnreferencedModsAfterRetention(t *testing.T) {
+	cfg, st, now := gcFixture(t)
+
+	report, err := Run(cfg, st, now, Options{})
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if len(report.RemovedMods) != 0 || report.PendingRetention != 1 {
+		t.Fatalf("first run should only start the retention clock: %+v", report)
+	}
+	if since := st.Mods["2"].UnreferencedSince; since == nil || !since.Equal(now) {
+		t.Fatalf("unreferenced_since = %v, want %v", since, now)
+	}
+
+	report, err = Run(cfg, st, now.Add(23*time.Hour), Options{})
+	if err != nil || len(report.RemovedMods) != 0 {
+		t.Fatalf("run inside retention removed mods: %+v, %v", report, err)
+	}
+
+	report, err = Run(cfg, st, now.Add(25*time.Hour), Options{})
+	if err != nil {
+		t.Fatalf("run after retention: %v", err)
+	}
+	if len(report.RemovedMods) != 1 || report.RemovedMods[0] != "2" {
+		t.Fatalf("removed mods = %v, want [2]", report.RemovedMods)
+	}
+	if report.BytesReclaimed != 260 {
+		t.Fatalf("bytes reclaimed = %d, want 260", report.BytesReclaimed)
+	}
+	if exists(filepath.Join(cfg.Paths.LocalModsRoot, "old")) || exists(filepath.Join(cfg.Paths.LocalCacheRoot, "hashes", "old.json")) {
+		t.Fatal("expected local copy and hash cache of mod 2 to be removed")
+	}
+	if !exists(filepath.Join(cfg.Paths.LocalModsRoot, "cf")) {
+		t.Fatal("referenced mod must be kept")
+	}
+	if _, ok := st.Mods["2"]; ok {
+		t.Fatal("expected state entry of mod 2 to be removed")
+	}
+	if !exists(filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "2")) {
+		t.Fatal("steamcmd content must be left alone unless prune_steamcmd_content is set")
+	}
+}
+
+func TestRunClearsRetentionClockWhenModIsReferencedAgain(t *testing.T) {
+	cfg, st, now := gcFixture(t)
+	if _, err := Run(cfg, st, now, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	st.Servers["a"] = state.ServerState{LastModIDs: []string{"1", "2"}}
+	if _, err := Run(cfg, st, now.Add(48*time.Hour), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if st.Mods["2"].UnreferencedSince != nil {
+		t.Fatal("expected retention clock to be cleared")
+	}
+	if !exists(filepath.Join(cfg.Paths.LocalModsRoot, "old")) {
+		t.Fatal("re-referenced mod must be kept")
+	}
+}
+
+func TestRunDryRunDeletesNothing(t *testing.T) {
+	cfg, st, now := gcFixture(t)
+	cfg.GC.PruneSteamCMDContent = true
+	since := now.Add(-48 * time.Hour)
+	mod := st.Mods["2"]
+	mod.UnreferencedSince = &since
+	st.Mods["2"] = mod
+
+	report, err := Run(cfg, st, now, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.RemovedMods) != 1 || len(report.SteamCMDPruned) != 2 {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+	if report.BytesReclaimed != 610 {
+		t.Fatalf("bytes reclaimed = %d, want 610", report.BytesReclaimed)
+	}
+	for _, p := range []string{
+		filepath.Join(cfg.Paths.LocalModsRoot, "old"),
+		filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "1"),
+		filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "2"),
+	} {
+		if !exists(p) {
+			t.Fatalf("dry run deleted %s", p)
+		}
+	}
+	if _, ok := st.Mods["2"]; !ok {
+		t.Fatal("dry run must not change state")
+	}
+}
+
+func TestRunPrunesSteamCMDContentOfMirroredMods(t *testing.T) {
+	cfg, st, now := gcFixture(t)
+	cfg.GC.PruneSteamCMDContent = true
+
+	report, err := Run(cfg, st, now, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.SteamCMDPruned) != 1 || report.SteamCMDPruned[0] != "1" {
+		t.Fatalf("steamcmd pruned = %v, want [1]", report.SteamCMDPruned)
+	}
+	if exists(filepath.Join(cfg.Paths.SteamcmdWorkshopContentRoot, "221100", "1")) {
+		t.Fatal("expected steamcmd copy of mirrored mod to be pruned")
+	}
+	if !exists(filepath.Join(cfg.Paths.LocalModsRoot, "cf", "addons", "cf.pbo")) {
+		t.Fatal("local mirror must be kept")
+	}
+}
+
+func TestRunCleansOldStagingEntries(t *testing.T) {
+	cfg, st, now := gcFixture(t)
+	staging := filepath.Join(cfg.Paths.LocalCacheRoot, "staging")
+	writeFile(t, filepath.Join(staging, "cf-123", "cf.pbo"), 40)
+	writeFile(t, filepath.Join(staging, "cf-456", "cf.pbo"), 40)
+	old := now.Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(staging, "cf-123"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(staging, "cf-456"), now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(cfg, st, now, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.StagingRemoved) != 1 || report.StagingRemoved[0] != "cf-123" {
+		t.Fatalf("staging removed = %v, want [cf-123]", report.StagingRemoved)
+	}
+	if report.BytesReclaimed != 40 {
+		t.Fatalf("bytes reclaimed = %d, want 40", report.BytesReclaimed)
+	}
+	if !exists(filepath.Join(staging, "cf-456")) {
+		t.Fatal("recent staging entry must be kept")
+	}
+}
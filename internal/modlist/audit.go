@@ -0,0 +1,115 @@
+package modlist
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+// ModsetChange is what ApplyPollResult detected between the previous and the
+// new modlist of one server.
+type ModsetChange struct {
+	ServerID           string       `json:"server_id"`
+	PreviousModsetHash string       `json:"previous_modset_hash"`
+	ModsetHash         string       `json:"modset_hash"`
+	Added              []HistoryMod `json:"added"`
+	Removed            []HistoryMod `json:"removed"`
+}
+
+func (c ModsetChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// AddedIDs returns the workshop IDs of added mods.
+func (c ModsetChange) AddedIDs() []string {
+	return historyIDs(c.Added)
+}
+
+// RemovedIDs returns the workshop IDs of removed mods.
+func (c ModsetChange) RemovedIDs() []string {
+	return historyIDs(c.Removed)
+}
+
+// AuditEntry is one line of the append-only modlist audit log.
+type AuditEntry struct {
+	At time.Time `json:"at"`
+	ModsetChange
+}
+
+// AppendAudit appends entry as a JSON line to the audit log at p.
+func AppendAudit(p string, entry AuditEntry) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mergePendingChanges folds a new change into the changes accumulated since
+// the last restart; a mod added and then removed again cancels out.
+func mergePendingChanges(pending *state.ModsetChanges, added, removed []string) *state.ModsetChanges {
+	addedSet := map[string]struct{}{}
+	removedSet := map[string]struct{}{}
+	if pending != nil {
+		for _, id := range pending.Added {
+			addedSet[id] = struct{}{}
+		}
+		for _, id := range pending.Removed {
+			removedSet[id] = struct{}{}
+		}
+	}
+	for _, id := range added {
+		if _, ok := removedSet[id]; ok {
+			delete(removedSet, id)
+			continue
+		}
+		addedSet[id] = struct{}{}
+	}
+	for _, id := range removed {
+		if _, ok := addedSet[id]; ok {
+			delete(addedSet, id)
+			continue
+		}
+		removedSet[id] = struct{}{}
+	}
+	if len(addedSet) == 0 && len(removedSet) == 0 {
+		return nil
+	}
+	return &state.ModsetChanges{Added: sortedKeys(addedSet), Removed: sortedKeys(removedSet)}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func historyIDs(mods []HistoryMod) []string {
+	out := make([]string, 0, len(mods))
+	for _, mod := range mods {
+		out = append(out, mod.WorkshopID)
+	}
+	return out
+}
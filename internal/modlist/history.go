@@ -0,0 +1,170 @@
+package modlist
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+const (
+	historyDirName = "history"
+	historyLimit   = 20
+)
+
+// HistoryEntry describes one modlist change. The replaced modlist is archived
+// next to it as <stamp>.html.
+type HistoryEntry struct {
+	DetectedAt         time.Time    `json:"detected_at"`
+	RemoteMTime        time.Time    `json:"remote_mtime"`
+	RemoteSize         int64        `json:"remote_size"`
+	PreviousModsetHash string       `json:"previous_modset_hash"`
+	ModsetHash         string       `json:"modset_hash"`
+	Added              []HistoryMod `json:"added"`
+	Removed            []HistoryMod `json:"removed"`
+}
+
+type HistoryMod struct {
+	WorkshopID  string `json:"workshop_id"`
+	DisplayName string `json:"display_name"`
+}
+
+// DiffModIDs returns the sorted IDs present only in next (added) and only in
+// prev (removed).
+func DiffModIDs(prev, next []string) (added, removed []string) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, id := range prev {
+		prevSet[id] = struct{}{}
+	}
+	nextSet := make(map[string]struct{}, len(next))
+	for _, id := range next {
+		nextSet[id] = struct{}{}
+		if _, ok := prevSet[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for _, id := range prev {
+		if _, ok := nextSet[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// recordHistory archives the replaced modlist and its diff against the new
+// one under <serverDir>/history, keeping the newest historyLimit entries.
+func recordHistory(serverDir string, previous, current []byte, stat state.RemoteFileStat, now time.Time) error {
+	prevMods := ParseHTMLModlist(string(previous), nil)
+	nextMods := ParseHTMLModlist(string(current), nil)
+	names := map[string]string{}
+	prevIDs := make([]string, 0, len(prevMods))
+	for _, mod := range prevMods {
+		prevIDs = append(prevIDs, mod.WorkshopID)
+		names[mod.WorkshopID] = mod.DisplayName
+	}
+	nextIDs := make([]string, 0, len(nextMods))
+	for _, mod := range nextMods {
+		nextIDs = append(nextIDs, mod.WorkshopID)
+		names[mod.WorkshopID] = mod.DisplayName
+	}
+	added, removed := DiffModIDs(prevIDs, nextIDs)
+	sort.Strings(prevIDs)
+	sort.Strings(nextIDs)
+
+	entry := HistoryEntry{
+		DetectedAt:         now.UTC(),
+		RemoteMTime:        time.Unix(stat.MTime, 0).UTC(),
+		RemoteSize:         stat.Size,
+		PreviousModsetHash: HashModset(prevIDs),
+		ModsetHash:         HashModset(nextIDs),
+		Added:              historyMods(added, names),
+		Removed:            historyMods(removed, names),
+	}
+
+	dir := filepath.Join(serverDir, historyDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+	if err := os.WriteFile(filepath.Join(dir, stamp+".html"), previous, 0o644); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, stamp+".json"), b, 0o644); err != nil {
+		return err
+	}
+	return pruneHistory(dir, historyLimit)
+}
+
+// ReadHistory returns the recorded modlist changes for a server, oldest first.
+func ReadHistory(localCacheRoot, serverID string) ([]HistoryEntry, error) {
+	dir := filepath.Join(localCacheRoot, "servers", serverID, historyDirName)
+	stamps, err := historyStamps(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]HistoryEntry, 0, len(stamps))
+	for _, stamp := range stamps {
+		b, err := os.ReadFile(filepath.Join(dir, stamp+".json"))
+		if err != nil {
+			return nil, err
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(b, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func historyMods(ids []string, names map[string]string) []HistoryMod {
+	out := make([]HistoryMod, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, HistoryMod{WorkshopID: id, DisplayName: names[id]})
+	}
+	return out
+}
+
+func historyStamps(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	stamps := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if stamp, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			stamps = append(stamps, stamp)
+		}
+	}
+	sort.Strings(stamps)
+	return stamps, nil
+}
+
+func pruneHistory(dir string, keep int) error {
+	stamps, err := historyStamps(dir)
+	if err != nil {
+		return err
+	}
+	for len(stamps) > keep {
+		for _, ext := range []string{".json", ".html"} {
+			if err := os.Remove(filepath.Join(dir, stamps[0]+ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		stamps = stamps[1:]
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package modlist
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -15,9 +16,8 @@ import (
 	"time"
 
 	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/sshpool"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
-	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
 )
 
 type Provider interface {
@@ -40,6 +40,8 @@ type PollResult struct {
 	SortedIDs  []string
 	ModsetHash string
 	CachePath  string
+	Stat       state.RemoteFileStat
+	Unchanged  bool
 }
 
 var (
@@ -61,33 +63,57 @@ func (p *StaticProvider) Load() ([]config.ModConfig, error) {
 	return p.mods, nil
 }
 
-func PollServerModlist(ctx context.Context, srv config.ServerConfig, localCacheRoot string, warnf func(string, ...any)) (PollResult, error) {
-	html, cachePath, err := fetchModlistHTML(ctx, srv, localCacheRoot)
+// Poller fetches server modlists over pooled SSH connections.
+type Poller struct {
+	pool *sshpool.Pool
+	now  func() time.Time
+}
+
+func NewPoller(pool *sshpool.Pool) *Poller {
+	return &Poller{pool: pool, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// PollServerModlist polls over a dedicated connection that is closed afterwards.
+func PollServerModlist(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat, warnf func(string, ...any)) (PollResult, error) {
+	return NewPoller(nil).Poll(ctx, srv, localCacheRoot, prev, warnf)
+}
+
+// Poll stats the remote modlist and only downloads it when its size or mtime
+// differ from prev; otherwise the cached copy is parsed.
+func (p *Poller) Poll(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat, warnf func(string, ...any)) (PollResult, error) {
+	fetched, err := p.fetchModlistHTML(ctx, srv, localCacheRoot, prev)
 	if err != nil {
 		return PollResult{}, err
 	}
-
-	mods := ParseHTMLModlist(html, warnf)
+	mods := ParseHTMLModlist(fetched.html, warnf)
 	ids := make([]string, 0, len(mods))
 	for _, mod := range mods {
 		ids = append(ids, mod.WorkshopID)
 	}
 	sort.Strings(ids)
-
 	return PollResult{
 		Mods:       mods,
 		SortedIDs:  ids,
 		ModsetHash: HashModset(ids),
-		CachePath:  cachePath,
+		CachePath:  fetched.cachePath,
+		Stat:       fetched.stat,
+		Unchanged:  fetched.unchanged,
 	}, nil
 }
 
-func fetchModlistHTML(ctx context.Context, srv config.ServerConfig, localCacheRoot string) (string, string, error) {
+type fetchedModlist struct {
+	html      string
+	cachePath string
+	stat      state.RemoteFileStat
+	unchanged bool
+}
+
+func (p *Poller) fetchModlistHTML(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat) (fetchedModlist, error) {
 	var lastErr error
 	for attempt := 1; attempt <= srv.SFTP.MaxRetries; attempt++ {
-		html, cachePath, err := fetchModlistHTMLOnce(ctx, srv, localCacheRoot)
+		fetched, err := p.fetchModlistHTMLOnce(ctx, srv, localCacheRoot, prev)
 		if err == nil {
-			return html, cachePath, nil
+			return fetched, nil
 		}
 		lastErr = err
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || attempt == srv.SFTP.MaxRetries {
@@ -95,60 +121,51 @@ func fetchModlistHTML(ctx context.Context, srv config.ServerConfig, localCacheRo
 		}
 		select {
 		case <-ctx.Done():
-			return "", "", ctx.Err()
+			return fetchedModlist{}, ctx.Err()
 		case <-time.After(time.Duration(srv.SFTP.RetryBackoffMillis*attempt) * time.Millisecond):
 		}
 	}
-	return "", "", lastErr
+	return fetchedModlist{}, lastErr
 }
 
-func fetchModlistHTMLOnce(ctx context.Context, srv config.ServerConfig, localCacheRoot string) (string, string, error) {
+func (p *Poller) fetchModlistHTMLOnce(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat) (fetchedModlist, error) {
 	opCtx, cancel := context.WithTimeout(ctx, time.Duration(srv.SFTP.OperationTimeoutSeconds)*time.Second)
 	defer cancel()
 
-	address := fmt.Sprintf("%s:%d", srv.SFTP.Host, srv.SFTP.Port)
-	sshConfig, err := sshConfigFromServer(srv)
+	lease, err := p.pool.Acquire(opCtx, srv)
 	if err != nil {
-		return "", "", err
+		return fetchedModlist{}, err
 	}
-	connCh := make(chan struct {
-		conn *ssh.Client
-		err  error
-	}, 1)
-	go func() {
-		conn, err := ssh.Dial("tcp", address, sshConfig)
-		connCh <- struct {
-			conn *ssh.Client
-			err  error
-		}{conn: conn, err: err}
-	}()
-	var conn *ssh.Client
-	select {
-	case <-opCtx.Done():
-		return "", "", opCtx.Err()
-	case res := <-connCh:
-		if res.err != nil {
-			return "", "", fmt.Errorf("dial sftp ssh for server %q: %w", srv.ID, res.err)
-		}
-		conn = res.conn
-	}
-	defer conn.Close()
-	client, err := sftp.NewClient(conn)
-	if err != nil {
-		return "", "", fmt.Errorf("create sftp client for server %q: %w", srv.ID, err)
-	}
-	defer client.Close()
+	var connErr error
+	defer func() { lease.Release(connErr) }()
+	client := lease.SFTP
 
 	remotePath := srv.SFTP.RemoteModlistPath
 	if strings.TrimSpace(remotePath) == "" {
 		remotePath = "/modlist.html"
 	}
+	cachePath := filepath.Join(localCacheRoot, "servers", srv.ID, "modlist.html")
+
 	type result struct {
-		content []byte
-		err     error
+		content   []byte
+		stat      state.RemoteFileStat
+		unchanged bool
+		err       error
 	}
 	resCh := make(chan result, 1)
 	go func() {
+		info, err := client.Stat(remotePath)
+		if err != nil {
+			resCh <- result{err: fmt.Errorf("stat remote modlist for server %q: %w", srv.ID, err)}
+			return
+		}
+		stat := state.RemoteFileStat{Size: info.Size(), MTime: info.ModTime().Unix()}
+		if prev != nil && *prev == stat {
+			if cached, err := os.ReadFile(cachePath); err == nil {
+				resCh <- result{content: cached, stat: stat, unchanged: true}
+				return
+			}
+		}
 		remoteFile, err := client.Open(remotePath)
 		if err != nil {
 			resCh <- result{err: fmt.Errorf("open remote modlist for server %q: %w", srv.ID, err)}
@@ -160,54 +177,39 @@ func fetchModlistHTMLOnce(ctx context.Context, srv config.ServerConfig, localCac
 			resCh <- result{err: fmt.Errorf("read remote modlist for server %q: %w", srv.ID, err)}
 			return
 		}
-		resCh <- result{content: content}
+		resCh <- result{content: content, stat: stat}
 	}()
 
 	select {
 	case <-opCtx.Done():
-		return "", "", opCtx.Err()
+		if sshpool.ConnectionBroken(opCtx.Err()) {
+			connErr = opCtx.Err()
+		}
+		return fetchedModlist{}, opCtx.Err()
 	case res := <-resCh:
 		if res.err != nil {
-			return "", "", res.err
-		}
-		cachePath := filepath.Join(localCacheRoot, "servers", srv.ID, "modlist.html")
-		if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
-			return "", "", fmt.Errorf("create modlist cache dir for server %q: %w", srv.ID, err)
+			if sshpool.ConnectionBroken(res.err) {
+				connErr = res.err
+			}
+			return fetchedModlist{}, res.err
 		}
-		if err := os.WriteFile(cachePath, res.content, 0o644); err != nil {
-			return "", "", fmt.Errorf("write cached modlist for server %q: %w", srv.ID, err)
+		fetched := fetchedModlist{html: string(res.content), cachePath: cachePath, stat: res.stat, unchanged: res.unchanged}
+		if res.unchanged {
+			return fetched, nil
 		}
-		return string(res.content), cachePath, nil
-	}
-}
-
-func sshConfigFromServer(srv config.ServerConfig) (*ssh.ClientConfig, error) {
-	authMethods := make([]ssh.AuthMethod, 0, 1)
-	switch srv.SFTP.Auth.Type {
-	case "password":
-		authMethods = append(authMethods, ssh.Password(srv.SFTP.Auth.Password))
-	case "private_key":
-		keyBytes, err := os.ReadFile(srv.SFTP.Auth.PrivateKeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("read private key for server %q: %w", srv.ID, err)
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+			return fetchedModlist{}, fmt.Errorf("create modlist cache dir for server %q: %w", srv.ID, err)
 		}
-		signer, err := ssh.ParsePrivateKey(keyBytes)
-		if err != nil && srv.SFTP.Auth.Passphrase != "" {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(srv.SFTP.Auth.Passphrase))
+		if previous, err := os.ReadFile(cachePath); err == nil && !bytes.Equal(previous, res.content) {
+			if err := recordHistory(filepath.Dir(cachePath), previous, res.content, res.stat, p.now()); err != nil {
+				return fetchedModlist{}, fmt.Errorf("record modlist history for server %q: %w", srv.ID, err)
+			}
 		}
-		if err != nil {
-			return nil, fmt.Errorf("parse private key for server %q: %w", srv.ID, err)
+		if err := os.WriteFile(cachePath, res.content, 0o644); err != nil {
+			return fetchedModlist{}, fmt.Errorf("write cached modlist for server %q: %w", srv.ID, err)
 		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	default:
-		return nil, fmt.Errorf("unsupported sftp auth type %q for server %q", srv.SFTP.Auth.Type, srv.ID)
+		return fetched, nil
 	}
-
-	return &ssh.ClientConfig{
-		User:            srv.SFTP.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}, nil
 }
 
 func ParseHTMLModlist(html string, warnf func(string, ...any)) []ParsedMod {
@@ -274,14 +276,37 @@ func SlugifyFolder(displayName, workshopID string) string {
 	return slug
 }
 
-func ApplyPollResult(st *state.State, serverID string, result PollResult) {
+// ApplyPollResult records a poll in state and returns the mods added and
+// removed since the previous poll. The first poll of a server is a baseline
+// and reports no change.
+func ApplyPollResult(st *state.State, serverID string, result PollResult) ModsetChange {
 	server := st.Servers[serverID]
 	if server.SyncedMods == nil {
 		server.SyncedMods = map[string]time.Time{}
 	}
 	previousHash := server.LastModsetHash
+	change := ModsetChange{ServerID: serverID, PreviousModsetHash: previousHash, ModsetHash: result.ModsetHash}
+	if previousHash != "" && previousHash != result.ModsetHash {
+		names := make(map[string]string, len(result.Mods))
+		for _, mod := range result.Mods {
+			names[mod.WorkshopID] = mod.DisplayName
+		}
+		for _, id := range server.LastModIDs {
+			if _, ok := names[id]; !ok {
+				names[id] = st.Mods[id].DisplayName
+			}
+		}
+		added, removed := DiffModIDs(server.LastModIDs, result.SortedIDs)
+		change.Added = historyMods(added, names)
+		change.Removed = historyMods(removed, names)
+		server.PendingChanges = mergePendingChanges(server.PendingChanges, added, removed)
+	}
 	server.LastModIDs = append([]string(nil), result.SortedIDs...)
 	server.LastModsetHash = result.ModsetHash
+	if result.Stat != (state.RemoteFileStat{}) {
+		stat := result.Stat
+		server.ModlistStat = &stat
+	}
 	if previousHash != "" && previousHash != result.ModsetHash {
 		server.NeedsModUpdate = true
 		server.Stage = state.StagePlanning
@@ -294,4 +319,5 @@ func ApplyPollResult(st *state.State, serverID string, result PollResult) {
 		existing.FolderSlug = mod.FolderSlug
 		st.Mods[mod.WorkshopID] = existing
 	}
+	return change
 }
@@ -1,8 +1,16 @@
 package modlist
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/sshpool"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
 )
 
@@ -79,6 +87,7 @@ func TestApplyPollResultUpdatesState(t *testing.T) {
 		Mods:       []ParsedMod{{DisplayName: "CF Tools", WorkshopID: "1564026768", FolderSlug: "cf-tools"}},
 		SortedIDs:  []string{"1564026768"},
 		ModsetHash: HashModset([]string{"1564026768"}),
+		Stat:       state.RemoteFileStat{Size: 120, MTime: 1700000000},
 	})
 
 	srv := st.Servers["s1"]
@@ -91,7 +100,153 @@ func TestApplyPollResultUpdatesState(t *testing.T) {
 	if len(srv.LastModIDs) != 1 || srv.LastModIDs[0] != "1564026768" {
 		t.Fatalf("unexpected last_mod_ids: %#v", srv.LastModIDs)
 	}
+	if srv.ModlistStat == nil || srv.ModlistStat.Size != 120 {
+		t.Fatalf("expected modlist stat to be recorded, got %#v", srv.ModlistStat)
+	}
 	if st.Mods["1564026768"].DisplayName != "CF Tools" {
 		t.Fatalf("unexpected display_name in state: %#v", st.Mods["1564026768"])
 	}
 }
+
+const cfToolsModlist = `<table><tr data-type="ModContainer">
+  <td data-type="DisplayName">CF Tools</td>
+  <td><a data-type="Link" href="https://steamcommunity.com/sharedfiles/filedetails/?id=1564026768">Open</a></td>
+</tr></table>`
+
+func pollTestServer() config.ServerConfig {
+	return config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{
+		Host: "h", Port: 22, User: "u",
+		Auth:                    config.SFTPAuthConfig{Type: "password", Password: "p"},
+		RemoteModlistPath:       "/modlist.html",
+		ConnectTimeoutSeconds:   5,
+		OperationTimeoutSeconds: 5,
+		MaxRetries:              1,
+	}}
+}
+
+func TestPollSkipsDownloadWhenRemoteStatUnchanged(t *testing.T) {
+	root := t.TempDir()
+	cachePath := filepath.Join(root, "servers", "s1", "modlist.html")
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, []byte(cfToolsModlist), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prev := &state.RemoteFileStat{Size: 0, MTime: 0}
+	result, err := NewPoller(nil).Poll(context.Background(), pollTestServer(), root, prev, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Unchanged || len(result.SortedIDs) != 1 || result.SortedIDs[0] != "1564026768" {
+		t.Fatalf("expected cached modlist to be reused, got %#v", result)
+	}
+}
+
+func TestPollRecordsHistoryWhenModlistChanges(t *testing.T) {
+	root := t.TempDir()
+	cachePath := filepath.Join(root, "servers", "s1", "modlist.html")
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, []byte(cfToolsModlist), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prev := &state.RemoteFileStat{Size: 321, MTime: 1700000000}
+	result, err := NewPoller(nil).Poll(context.Background(), pollTestServer(), root, prev, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unchanged || len(result.SortedIDs) != 0 {
+		t.Fatalf("expected fresh download, got %#v", result)
+	}
+	history, err := ReadHistory(root, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || len(history[0].Removed) != 1 || history[0].Removed[0].DisplayName != "CF Tools" || len(history[0].Added) != 0 {
+		t.Fatalf("unexpected modlist history: %#v", history)
+	}
+}
+
+func TestPollKeepsConnectionWhenModlistMissing(t *testing.T) {
+	pool := sshpool.New(30*time.Second, 5*time.Minute)
+	defer pool.Close()
+	srv := pollTestServer()
+	srv.SFTP.RemoteModlistPath = "/profiles/missing.html"
+	_, err := NewPoller(pool).Poll(context.Background(), srv, t.TempDir(), nil, nil)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing modlist error, got %v", err)
+	}
+	if pool.Len() != 1 {
+		t.Fatalf("expected the connection to stay pooled, got %d", pool.Len())
+	}
+}
+
+func TestDiffModIDs(t *testing.T) {
+	added, removed := DiffModIDs([]string{"1", "2", "3"}, []string{"4", "2", "1"})
+	if len(added) != 1 || added[0] != "4" || len(removed) != 1 || removed[0] != "3" {
+		t.Fatalf("unexpected diff: added=%v removed=%v", added, removed)
+	}
+}
+
+func TestPruneHistoryKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	for _, stamp := range []string{"20240101T000000Z", "20240102T000000Z", "20240103T000000Z"} {
+		for _, ext := range []string{".json", ".html"} {
+			if err := os.WriteFile(filepath.Join(dir, stamp+ext), []byte("{}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := pruneHistory(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	stamps, err := historyStamps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stamps) != 2 || stamps[0] != "20240102T000000Z" {
+		t.Fatalf("unexpected stamps after prune: %v", stamps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20240101T000000Z.html")); !os.IsNotExist(err) {
+		t.Fatalf("expected archived html to be pruned, got %v", err)
+	}
+}
+
+func TestApplyPollResultReportsAddedAndRemovedMods(t *testing.T) {
+	st := state.State{
+		Mods: map[string]state.ModState{"1": {DisplayName: "Old Mod"}},
+		Servers: map[string]state.ServerState{"s1": {
+			LastModIDs:     []string{"1"},
+			LastModsetHash: HashModset([]string{"1"}),
+			PendingChanges: &state.ModsetChanges{Added: []string{"1"}},
+		}},
+	}
+	change := ApplyPollResult(&st, "s1", PollResult{
+		Mods:       []ParsedMod{{DisplayName: "CF Tools", WorkshopID: "2", FolderSlug: "cf-tools"}},
+		SortedIDs:  []string{"2"},
+		ModsetHash: HashModset([]string{"2"}),
+	})
+	if len(change.Added) != 1 || change.Added[0].DisplayName != "CF Tools" || len(change.Removed) != 1 || change.Removed[0].DisplayName != "Old Mod" {
+		t.Fatalf("unexpected change: %#v", change)
+	}
+	pending := st.Servers["s1"].PendingChanges
+	if pending == nil || len(pending.Added) != 1 || pending.Added[0] != "2" || len(pending.Removed) != 0 {
+		t.Fatalf("expected add-then-remove to cancel out, got %#v", pending)
+	}
+
+	log := filepath.Join(t.TempDir(), "audit", "modlist.jsonl")
+	for i := 0; i < 2; i++ {
+		if err := AppendAudit(log, AuditEntry{At: time.Unix(1700000000, 0).UTC(), ModsetChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 2 || !strings.Contains(string(b), `"server_id":"s1"`) {
+		t.Fatalf("unexpected audit log: %s", b)
+	}
+}
@@ -2,15 +2,20 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
+	"github.com/example/dayz-standalone-mode-updater/internal/gc"
 	"github.com/example/dayz-standalone-mode-updater/internal/logging"
 	"github.com/example/dayz-standalone-mode-updater/internal/modlist"
+	"github.com/example/dayz-standalone-mode-updater/internal/pbo"
 	"github.com/example/dayz-standalone-mode-updater/internal/rcon"
 	"github.com/example/dayz-standalone-mode-updater/internal/sftpsync"
+	"github.com/example/dayz-standalone-mode-updater/internal/sshpool"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
 	"github.com/example/dayz-standalone-mode-updater/internal/steamcmd"
 	"github.com/example/dayz-standalone-mode-updater/internal/workshop"
@@ -28,50 +33,73 @@ type rconTicker interface {
 	Tick(ctx context.Context, now time.Time, st *state.State)
 }
 
-type modlistPollFn func(ctx context.Context, srv config.ServerConfig, localCacheRoot string, warnf func(string, ...any)) (modlist.PollResult, error)
+type modlistPollFn func(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat, warnf func(string, ...any)) (modlist.PollResult, error)
 
 type Orchestrator struct {
 	cfg          config.Config
 	store        state.StateStore
 	logger       logging.Logger
 	workshop     workshop.Client
+	changelog    workshop.ChangelogFetcher
 	steam        steamRunner
 	sync         syncEngine
 	rcon         rconTicker
 	pollModlist  modlistPollFn
+	pool         *sshpool.Pool
 	now          func() time.Time
 	steamBatchMu sync.Mutex
 }
 
 func New(cfg config.Config, logger logging.Logger) *Orchestrator {
+	pool := sshpool.New(
+		time.Duration(cfg.Intervals.SSHKeepaliveSeconds)*time.Second,
+		time.Duration(cfg.Intervals.SSHIdleCloseSeconds)*time.Second,
+		sftpsync.ClientOptions(cfg.Sync)...,
+	)
+	var changelog workshop.ChangelogFetcher
+	if cfg.Steam.Changelog.Enabled {
+		changelog = workshop.NewChangelogClient(cfg.Steam)
+	}
 	return &Orchestrator{
 		cfg:         cfg,
 		store:       state.NewFileStore(cfg.StatePath),
 		logger:      logger,
-		workshop:    workshop.NewWebAPIClient(cfg.Steam.WebAPIKey, time.Duration(cfg.Steam.WorkshopHTTPTimeoutSeconds)*time.Second, cfg.Steam.WorkshopMaxRetries, time.Duration(cfg.Steam.WorkshopBackoffMillis)*time.Millisecond),
+		workshop:    workshop.NewClient(cfg.Steam),
+		changelog:   changelog,
 		steam:       steamcmd.NewRunner(cfg),
-		sync:        sftpsync.NewEngine(),
+		sync:        sftpsync.NewEngine().WithPool(pool),
 		rcon:        rcon.NewController(cfg),
-		pollModlist: modlist.PollServerModlist,
+		pollModlist: modlist.NewPoller(pool).Poll,
+		pool:        pool,
 		now:         func() time.Time { return time.Now().UTC() },
 	}
 }
 
 func (o *Orchestrator) Run(ctx context.Context) error {
 	o.logger.Info("orchestrator started", map[string]any{
-		"modlist_poll_seconds":  o.cfg.Intervals.ModlistPollSeconds,
-		"workshop_poll_seconds": o.cfg.Intervals.WorkshopPollSeconds,
-		"rcon_tick_seconds":     o.cfg.Intervals.RconTickSeconds,
+		"modlist_poll_seconds":      o.cfg.Intervals.ModlistPollSeconds,
+		"workshop_poll_seconds":     o.cfg.Intervals.WorkshopPollSeconds,
+		"workshop_poll_min_seconds": o.cfg.Intervals.WorkshopPollMinSeconds,
+		"workshop_poll_max_seconds": o.cfg.Intervals.WorkshopPollMaxSeconds,
+		"rcon_tick_seconds":         o.cfg.Intervals.RconTickSeconds,
 	})
 
 	modlistTicker := time.NewTicker(time.Duration(o.cfg.Intervals.ModlistPollSeconds) * time.Second)
-	workshopTicker := time.NewTicker(time.Duration(o.cfg.Intervals.WorkshopPollSeconds) * time.Second)
+	workshopTicker := time.NewTicker(o.workshopTick())
 	rconTicker := time.NewTicker(time.Duration(o.cfg.Intervals.RconTickSeconds) * time.Second)
 	flushTicker := time.NewTicker(time.Duration(o.cfg.Intervals.StateFlushSeconds) * time.Second)
 	defer modlistTicker.Stop()
 	defer workshopTicker.Stop()
 	defer rconTicker.Stop()
 	defer flushTicker.Stop()
+	var gcTick <-chan time.Time
+	if o.cfg.GC.Enabled {
+		gcTicker := time.NewTicker(time.Duration(o.cfg.GC.IntervalHours) * time.Hour)
+		defer gcTicker.Stop()
+		gcTick = gcTicker.C
+	}
+	defer o.pool.Close()
+	go o.pool.Run(ctx)
 
 	for {
 		select {
@@ -89,16 +117,34 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 			if err := o.flushState(); err != nil {
 				o.logger.Error("state flush failed", err, nil)
 			}
+		case <-gcTick:
+			o.runGC()
 		}
 	}
 }
 
+// workshopTick is the shortest per-mod poll interval; PollMetadata skips the
+// mods that are not due yet.
+func (o *Orchestrator) workshopTick() time.Duration {
+	seconds := o.cfg.Intervals.WorkshopPollSeconds
+	if m := o.cfg.Intervals.WorkshopPollMinSeconds; m > 0 && m < seconds {
+		seconds = m
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func (o *Orchestrator) runModlistPoll(ctx context.Context) {
+	snapshot, err := o.store.Load()
+	if err != nil {
+		o.logger.Error("modlist poll state load failed", err, nil)
+		return
+	}
 	sem := make(chan struct{}, o.cfg.Concurrency.ModlistPollParallelism)
 	var wg sync.WaitGroup
 
 	for _, srv := range o.cfg.Servers {
 		srv := srv
+		prev := snapshot.Servers[srv.ID].ModlistStat
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -109,68 +155,192 @@ func (o *Orchestrator) runModlistPoll(ctx context.Context) {
 			}
 			defer func() { <-sem }()
 
-			result, err := o.pollModlist(ctx, srv, o.cfg.Paths.LocalCacheRoot, func(format string, args ...any) {
+			result, err := o.pollModlist(ctx, srv, o.cfg.Paths.LocalCacheRoot, prev, func(format string, args ...any) {
 				o.logger.Info(fmt.Sprintf(format, args...), map[string]any{"server_id": srv.ID})
 			})
 			if err != nil {
 				o.logger.Error("modlist poll failed", err, map[string]any{"server_id": srv.ID})
 				return
 			}
+			var change modlist.ModsetChange
 			if err := o.store.Update(func(st *state.State) error {
-				modlist.ApplyPollResult(st, srv.ID, result)
+				change = modlist.ApplyPollResult(st, srv.ID, result)
 				return nil
 			}); err != nil {
 				o.logger.Error("failed to persist modlist poll", err, map[string]any{"server_id": srv.ID})
+				return
+			}
+			if !change.Empty() {
+				o.recordModsetChange(change)
 			}
 		}()
 	}
 	wg.Wait()
 }
 
+func (o *Orchestrator) recordModsetChange(change modlist.ModsetChange) {
+	o.logger.Info("modlist changed", map[string]any{
+		"server_id":   change.ServerID,
+		"added":       change.AddedIDs(),
+		"removed":     change.RemovedIDs(),
+		"modset_hash": change.ModsetHash,
+	})
+	if o.cfg.Paths.ModlistAuditLog == "" {
+		return
+	}
+	if err := modlist.AppendAudit(o.cfg.Paths.ModlistAuditLog, modlist.AuditEntry{At: o.now(), ModsetChange: change}); err != nil {
+		o.logger.Error("modlist audit append failed", err, map[string]any{"server_id": change.ServerID})
+	}
+}
+
 func (o *Orchestrator) runWorkshopPoll(ctx context.Context) {
 	modsToUpdate := make([]string, 0)
-	err := o.store.Update(func(st *state.State) error {
-		var err error
-		modsToUpdate, err = workshop.PollMetadata(ctx, o.cfg, st, o.workshop, o.now())
-		return err
-	})
+	// Failed batches are recorded on their mods and the rest of the poll is
+	// kept, like a skipped mod in the SteamCMD batch.
+	var partial *workshop.PollError
+	// The metadata is fetched from a snapshot so rate limiter and Retry-After
+	// waits do not hold the state lock; only applying it does.
+	now := o.now()
+	snapshot, err := o.store.Load()
 	if err != nil {
 		o.logger.Error("workshop poll failed", err, nil)
 		return
 	}
-	if len(modsToUpdate) == 0 {
-		return
+	poll, err := workshop.FetchPoll(ctx, o.cfg, o.workshop, workshop.DueForPoll(o.cfg, &snapshot, now))
+	if err == nil {
+		err = o.store.Update(func(st *state.State) error {
+			var err error
+			modsToUpdate, err = poll.Apply(st, now)
+			if errors.As(err, &partial) {
+				return nil
+			}
+			return err
+		})
 	}
-	if err := o.runSteamCMDBatch(ctx, modsToUpdate); err != nil {
-		o.logger.Error("steamcmd batch failed", err, nil)
+	if err != nil {
+		o.logger.Error("workshop poll failed", err, nil)
 		return
 	}
+	if partial != nil {
+		o.logger.Error("workshop poll partially failed", partial, map[string]any{
+			"failed_mods":    partial.FailedIDs(),
+			"failed_batches": len(partial.Batches),
+			"requested_mods": partial.Requested,
+		})
+	}
+	if len(modsToUpdate) > 0 {
+		o.fetchChangelogs(ctx, modsToUpdate)
+		if err := o.runSteamCMDBatch(ctx, modsToUpdate); err != nil {
+			o.logger.Error("steamcmd batch failed", err, nil)
+			return
+		}
+	}
+	// Also runs without updates: servers whose deep verify is due are
+	// checked on their own schedule.
 	if err := o.runSFTPSyncPhase(ctx); err != nil {
 		o.logger.Error("sftp sync phase failed", err, nil)
 	}
 }
 
+// fetchChangelogs is best effort: a mod without a changelog is still updated.
+// The pages are fetched from a snapshot so the state lock is not held while
+// waiting on the network or the rate limiter.
+func (o *Orchestrator) fetchChangelogs(ctx context.Context, mods []string) {
+	if o.changelog == nil {
+		return
+	}
+	now := o.now()
+	snapshot, err := o.store.Load()
+	if err != nil {
+		o.logger.Error("failed to load state for workshop changelogs", err, nil)
+		return
+	}
+	due := workshop.DueChangelogs(&snapshot, mods, now)
+	if len(due) == 0 {
+		return
+	}
+	results := workshop.FetchChangelogs(ctx, o.changelog, due)
+	if err := o.store.Update(func(st *state.State) error {
+		if err := workshop.ApplyChangelogs(st, results, now); err != nil {
+			o.logger.Error("workshop changelog fetch failed", err, nil)
+		}
+		return nil
+	}); err != nil {
+		o.logger.Error("failed to persist workshop changelogs", err, nil)
+	}
+}
+
 func (o *Orchestrator) runSteamCMDBatch(ctx context.Context, mods []string) error {
 	o.steamBatchMu.Lock()
 	defer o.steamBatchMu.Unlock()
 
 	for _, modID := range mods {
+		// A failed disk preflight, content validation or a download failure
+		// of this mod skips it but keeps the error the runner recorded in
+		// state; the mod is retried on the next workshop poll. Failures that
+		// would hit every mod (bad credentials, rate limit, no connection)
+		// keep state and stop the batch.
+		var keptErr error
 		if err := o.store.Update(func(st *state.State) error {
 			_, err := o.steam.UpdateMods(ctx, []string{modID}, st)
+			if modSkipped(err) || steamcmd.StopsBatch(err) {
+				keptErr = err
+				return nil
+			}
 			return err
 		}); err != nil {
 			return fmt.Errorf("update mod %s: %w", modID, err)
 		}
+		if steamcmd.StopsBatch(keptErr) {
+			return fmt.Errorf("update mod %s: %w", modID, keptErr)
+		}
+		if keptErr != nil {
+			o.logger.Error("steamcmd mod skipped", keptErr, map[string]any{"mod_id": modID})
+		}
 	}
 	return nil
 }
 
+func modSkipped(err error) bool {
+	var invalid *pbo.ValidationError
+	return diskspace.IsInsufficient(err) || errors.As(err, &invalid) || steamcmd.ModFailed(err)
+}
+
 func (o *Orchestrator) runSFTPSyncPhase(ctx context.Context) error {
 	return o.store.Update(func(st *state.State) error {
 		return o.sync.SyncServers(ctx, o.cfg, st)
 	})
 }
 
+// runGC holds the SteamCMD batch lock so nothing is deleted while a download
+// or mirror into local_mods_root is in progress.
+func (o *Orchestrator) runGC() {
+	o.steamBatchMu.Lock()
+	defer o.steamBatchMu.Unlock()
+
+	var report gc.Report
+	var runErr error
+	if err := o.store.Update(func(st *state.State) error {
+		report, runErr = gc.Run(o.cfg, st, o.now(), gc.Options{})
+		return nil
+	}); err != nil {
+		o.logger.Error("gc state update failed", err, nil)
+		return
+	}
+	fields := map[string]any{
+		"removed_mods":      report.RemovedMods,
+		"staging_removed":   len(report.StagingRemoved),
+		"steamcmd_pruned":   len(report.SteamCMDPruned),
+		"bytes_reclaimed":   report.BytesReclaimed,
+		"pending_retention": report.PendingRetention,
+	}
+	if runErr != nil {
+		o.logger.Error("gc finished with errors", runErr, fields)
+		return
+	}
+	o.logger.Info("gc finished", fields)
+}
+
 func (o *Orchestrator) runRCONTick(ctx context.Context) {
 	if err := o.store.Update(func(st *state.State) error {
 		o.rcon.Tick(ctx, o.now(), st)
@@ -0,0 +1,164 @@
+package pbo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// File is a header entry with the position of its data in the archive.
+type File struct {
+	Entry
+	Offset int64
+}
+
+// Compressed reports whether the entry's data is LZSS compressed.
+func (f File) Compressed() bool {
+	return f.PackingMethod == PackingCompressed || (f.OriginalSize != 0 && f.OriginalSize != f.DataSize)
+}
+
+// Files returns the file table: every entry with its data offset.
+func (h *Header) Files() []File {
+	files := make([]File, 0, len(h.Entries))
+	offset := h.DataOffset
+	for _, e := range h.Entries {
+		files = append(files, File{Entry: e, Offset: offset})
+		offset += int64(e.DataSize)
+	}
+	return files
+}
+
+// Archive is an open PBO file.
+type Archive struct {
+	*Header
+	Size int64
+	f    *os.File
+}
+
+// Open reads the header of the PBO at p and keeps the file open for ReadFile.
+func Open(p string) (*Archive, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	h, err := ReadHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Archive{Header: h, Size: info.Size(), f: f}, nil
+}
+
+func (a *Archive) Close() error {
+	return a.f.Close()
+}
+
+// Lookup finds a file by name, ignoring case and accepting / or \ separators.
+func (a *Archive) Lookup(name string) (File, bool) {
+	name = strings.ReplaceAll(name, "/", `\`)
+	for _, f := range a.Files() {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// ReadFile returns the (decompressed) content of the named file.
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	f, ok := a.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	if f.PackingMethod == PackingEncrypted {
+		return nil, fmt.Errorf("%s: encrypted entries are not supported", name)
+	}
+	if f.Offset+int64(f.DataSize) > a.Size {
+		return nil, fmt.Errorf("%s: data extends past end of file", name)
+	}
+	data := make([]byte, f.DataSize)
+	if _, err := a.f.ReadAt(data, f.Offset); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if !f.Compressed() {
+		return data, nil
+	}
+	out, err := decompressLZSS(data, int(f.OriginalSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// decompressLZSS decodes BI's LZSS variant: a flag byte announces eight
+// items, set bits are literals and clear bits are two-byte back references
+// (12-bit distance, 4-bit length+3); references before the start of the
+// output yield spaces. A 4-byte additive checksum follows the data.
+func decompressLZSS(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	pos := 0
+	next := func() (byte, error) {
+		if pos >= len(in) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		b := in[pos]
+		pos++
+		return b, nil
+	}
+	for len(out) < size {
+		flags, err := next()
+		if err != nil {
+			return nil, err
+		}
+		for bit := 0; bit < 8 && len(out) < size; bit++ {
+			if flags&(1<<bit) != 0 {
+				b, err := next()
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, b)
+				continue
+			}
+			b1, err := next()
+			if err != nil {
+				return nil, err
+			}
+			b2, err := next()
+			if err != nil {
+				return nil, err
+			}
+			distance := int(b1) | int(b2&0xF0)<<4
+			if distance == 0 {
+				return nil, errors.New("invalid lzss back reference")
+			}
+			start := len(out) - distance
+			length := int(b2&0x0F) + 3
+			for i := 0; i < length && len(out) < size; i++ {
+				if start+i < 0 {
+					out = append(out, ' ')
+				} else {
+					out = append(out, out[start+i])
+				}
+			}
+		}
+	}
+	if pos+4 > len(in) {
+		return nil, errors.New("missing lzss checksum")
+	}
+	var sum uint32
+	for _, b := range out {
+		sum += uint32(b)
+	}
+	if want := binary.LittleEndian.Uint32(in[pos:]); sum != want {
+		return nil, fmt.Errorf("lzss checksum mismatch: got %d, want %d", sum, want)
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package pbo
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ModReport describes a local mod folder for `dayzmods inspect`.
+type ModReport struct {
+	Path            string    `json:"path"`
+	Addons          string    `json:"addons,omitempty"`
+	Keys            []KeyInfo `json:"keys"`
+	PBOs            []PBOInfo `json:"pbos"`
+	ValidationError string    `json:"validation_error,omitempty"`
+}
+
+type KeyInfo struct {
+	File      string `json:"file"`
+	Authority string `json:"authority"`
+}
+
+type PBOInfo struct {
+	File       string          `json:"file"`
+	Size       int64           `json:"size"`
+	Prefix     string          `json:"prefix,omitempty"`
+	Product    string          `json:"product,omitempty"`
+	Properties []Property      `json:"properties,omitempty"`
+	Entries    int             `json:"entries"`
+	DataSize   int64           `json:"data_size"`
+	Config     string          `json:"config,omitempty"`
+	Signatures []SignatureInfo `json:"signatures"`
+	Files      []FileInfo      `json:"files,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+type SignatureInfo struct {
+	File      string `json:"file"`
+	Authority string `json:"authority,omitempty"`
+	KnownKey  bool   `json:"known_key"`
+}
+
+type FileInfo struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	DataSize   int64  `json:"data_size"`
+	Offset     int64  `json:"offset"`
+	Compressed bool   `json:"compressed,omitempty"`
+	Timestamp  uint32 `json:"timestamp"`
+}
+
+type InspectOptions struct {
+	// Files includes every PBO's file table in the report.
+	Files    bool
+	Validate ValidateOptions
+}
+
+// configNames are looked up in this order when reporting a PBO's config.
+var configNames = []string{"config.cpp", "config.bin"}
+
+// InspectMod reports the PBOs, signatures and keys of the mod folder at dir.
+// Problems with single PBOs are reported per PBO instead of failing.
+func InspectMod(dir string, opts InspectOptions) (ModReport, error) {
+	report := ModReport{Path: dir, Keys: []KeyInfo{}, PBOs: []PBOInfo{}}
+	if _, err := os.Stat(dir); err != nil {
+		return report, err
+	}
+	keys, err := ModKeys(dir)
+	if err != nil {
+		return report, err
+	}
+	for authority, file := range keys {
+		report.Keys = append(report.Keys, KeyInfo{File: file, Authority: authority})
+	}
+	sort.Slice(report.Keys, func(i, j int) bool { return report.Keys[i].File < report.Keys[j].File })
+	if err := ValidateMod(dir, opts.Validate); err != nil {
+		report.ValidationError = err.Error()
+	}
+
+	addons, ok, err := findDir(dir, "addons")
+	if err != nil || !ok {
+		return report, err
+	}
+	report.Addons = addons
+	pbos, signatures, err := scanAddons(addons)
+	if err != nil {
+		return report, err
+	}
+	for _, name := range pbos {
+		info := inspectPBO(filepath.Join(addons, name), opts)
+		info.File = name
+		info.Signatures = []SignatureInfo{}
+		for _, sig := range signatures[strings.ToLower(name)] {
+			entry := SignatureInfo{File: sig}
+			if authority, err := ReadAuthority(filepath.Join(addons, sig)); err == nil {
+				entry.Authority = authority
+				_, entry.KnownKey = keys[authority]
+			}
+			info.Signatures = append(info.Signatures, entry)
+		}
+		report.PBOs = append(report.PBOs, info)
+	}
+	return report, nil
+}
+
+func inspectPBO(p string, opts InspectOptions) PBOInfo {
+	var info PBOInfo
+	a, err := Open(p)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	defer a.Close()
+	info.Size = a.Size
+	info.Prefix = a.Prefix()
+	info.Product = a.Product()
+	info.Properties = a.Properties
+	info.Entries = len(a.Entries)
+	info.DataSize = a.DataSize()
+	if err := a.checkSize(a.Size); err != nil {
+		info.Error = err.Error()
+	}
+	for _, name := range configNames {
+		if f, ok := a.Lookup(name); ok {
+			info.Config = f.Name
+			break
+		}
+	}
+	if opts.Files {
+		for _, f := range a.Files() {
+			size := int64(f.OriginalSize)
+			if size == 0 {
+				size = int64(f.DataSize)
+			}
+			info.Files = append(info.Files, FileInfo{
+				Name:       f.Name,
+				Size:       size,
+				DataSize:   int64(f.DataSize),
+				Offset:     f.Offset,
+				Compressed: f.Compressed(),
+				Timestamp:  f.Timestamp,
+			})
+		}
+	}
+	return info
+}
+
+// ExtractConfig returns the name and content of the PBO's config.cpp, or of
+// its binarized config.bin when there is no config.cpp.
+func ExtractConfig(p string) (string, []byte, error) {
+	a, err := Open(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer a.Close()
+	for _, name := range configNames {
+		if f, ok := a.Lookup(name); ok {
+			data, err := a.ReadFile(f.Name)
+			return f.Name, data, err
+		}
+	}
+	return "", nil, os.ErrNotExist
+}
@@ -0,0 +1,213 @@
+// Package pbo reads Bohemia Interactive PBO archives as shipped in DayZ mods.
+package pbo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Packing methods found in the header entries.
+const (
+	PackingNone       uint32 = 0
+	PackingVersion    uint32 = 0x56657273 // "Vers": header extension with properties
+	PackingCompressed uint32 = 0x43707273 // "Cprs"
+	PackingEncrypted  uint32 = 0x456e6372 // "Encr"
+)
+
+const (
+	maxNameLength = 1024
+	maxEntries    = 1 << 20
+)
+
+// Entry is one header entry. Name uses the PBO's backslash separators.
+type Entry struct {
+	Name          string
+	PackingMethod uint32
+	OriginalSize  uint32
+	Reserved      uint32
+	Timestamp     uint32
+	DataSize      uint32
+}
+
+type Property struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Header is the parsed header block of a PBO.
+type Header struct {
+	Properties []Property
+	Entries    []Entry
+	// DataOffset is where the first entry's data starts.
+	DataOffset int64
+}
+
+// Property returns the value of the header property key, or "".
+func (h *Header) Property(key string) string {
+	for _, p := range h.Properties {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// Prefix is the virtual path the game mounts the PBO under.
+func (h *Header) Prefix() string {
+	return h.Property("prefix")
+}
+
+func (h *Header) Product() string {
+	return h.Property("product")
+}
+
+// DataSize is the number of data bytes the header declares.
+func (h *Header) DataSize() int64 {
+	var total int64
+	for _, e := range h.Entries {
+		total += int64(e.DataSize)
+	}
+	return total
+}
+
+// ReadHeader parses the header block from the start of a PBO.
+func ReadHeader(r io.Reader) (*Header, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	h := &Header{}
+	first := true
+	for {
+		entry, err := readEntry(cr)
+		if err != nil {
+			return nil, fmt.Errorf("read header entry %d: %w", len(h.Entries), err)
+		}
+		if entry.Name == "" {
+			if first && entry.PackingMethod == PackingVersion {
+				props, err := readProperties(cr)
+				if err != nil {
+					return nil, fmt.Errorf("read properties: %w", err)
+				}
+				h.Properties = props
+				first = false
+				continue
+			}
+			break
+		}
+		first = false
+		if len(h.Entries) >= maxEntries {
+			return nil, fmt.Errorf("more than %d header entries", maxEntries)
+		}
+		h.Entries = append(h.Entries, entry)
+	}
+	h.DataOffset = cr.n
+	return h, nil
+}
+
+// ReadHeaderFile parses the header of the PBO at p and checks that the file
+// is large enough to hold all data the header declares.
+func ReadHeaderFile(p string) (*Header, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	return h, h.checkSize(info.Size())
+}
+
+func (h *Header) checkSize(size int64) error {
+	if want := h.DataOffset + h.DataSize(); size < want {
+		return fmt.Errorf("truncated: header declares %d bytes, file has %d", want, size)
+	}
+	return nil
+}
+
+func readEntry(r *countingReader) (Entry, error) {
+	name, err := readCString(r)
+	if err != nil {
+		return Entry{}, err
+	}
+	var fields [5]uint32
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return Entry{}, unexpectedEOF(err)
+	}
+	return Entry{
+		Name:          name,
+		PackingMethod: fields[0],
+		OriginalSize:  fields[1],
+		Reserved:      fields[2],
+		Timestamp:     fields[3],
+		DataSize:      fields[4],
+	}, nil
+}
+
+func readProperties(r *countingReader) ([]Property, error) {
+	var props []Property
+	for {
+		key, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return props, nil
+		}
+		value, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, Property{Key: key, Value: value})
+	}
+}
+
+func readCString(r *countingReader) (string, error) {
+	buf := make([]byte, 0, 64)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		if b == 0 {
+			return string(buf), nil
+		}
+		if len(buf) >= maxNameLength {
+			return "", fmt.Errorf("string longer than %d bytes", maxNameLength)
+		}
+		buf = append(buf, b)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
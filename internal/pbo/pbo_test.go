@@ -0,0 +1,234 @@
+package pbo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testFile struct {
+	name         string
+	data         string
+	originalSize uint32
+}
+
+func buildPBO(props []Property, files []testFile) []byte {
+	var buf bytes.Buffer
+	writeEntry := func(name string, fields ...uint32) {
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		_ = binary.Write(&buf, binary.LittleEndian, fields)
+	}
+	if props != nil {
+		writeEntry("", PackingVersion, 0, 0, 0, 0)
+		for _, p := range props {
+			buf.WriteString(p.Key + "\x00" + p.Value + "\x00")
+		}
+		buf.WriteByte(0)
+	}
+	for _, f := range files {
+		size := f.originalSize
+		if size == 0 {
+			size = uint32(len(f.data))
+		}
+		writeEntry(f.name, PackingNone, size, 0, 1700000000, uint32(len(f.data)))
+	}
+	writeEntry("", 0, 0, 0, 0, 0)
+	for _, f := range files {
+		buf.WriteString(f.data)
+	}
+	buf.WriteByte(0)
+	buf.Write(make([]byte, 20))
+	return buf.Bytes()
+}
+
+func writeTestFile(t *testing.T, p string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	data := buildPBO(
+		[]Property{{Key: "prefix", Value: `cf\tools`}, {Key: "product", Value: "dayz"}},
+		[]testFile{{name: "config.cpp", data: "class CfgPatches {};"}, {name: `data\icon.paa`, data: "paa"}},
+	)
+	h, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Properties) != 2 || h.Properties[0].Value != `cf\tools` {
+		t.Fatalf("unexpected properties: %#v", h.Properties)
+	}
+	if len(h.Entries) != 2 || h.Entries[1].Name != `data\icon.paa` || h.Entries[0].DataSize != 20 {
+		t.Fatalf("unexpected entries: %#v", h.Entries)
+	}
+	if got := data[h.DataOffset : h.DataOffset+20]; string(got) != "class CfgPatches {};" {
+		t.Fatalf("data offset points at %q", got)
+	}
+}
+
+func TestReadHeaderFileDetectsTruncation(t *testing.T) {
+	data := buildPBO(nil, []testFile{{name: "config.cpp", data: strings.Repeat("x", 100)}})
+	p := filepath.Join(t.TempDir(), "a.pbo")
+	writeTestFile(t, p, data[:len(data)-60])
+	if _, err := ReadHeaderFile(p); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected truncation error, got %v", err)
+	}
+	writeTestFile(t, p, data[:10])
+	if _, err := ReadHeaderFile(p); err == nil {
+		t.Fatal("expected error for cut-off header")
+	}
+}
+
+func writeSignedMod(t *testing.T, dir string) {
+	t.Helper()
+	writeTestFile(t, filepath.Join(dir, "Addons", "cf.pbo"), buildPBO([]Property{{Key: "prefix", Value: "cf"}}, []testFile{{name: "config.cpp", data: "x"}}))
+	writeTestFile(t, filepath.Join(dir, "Addons", "cf.pbo.CF_Key.bisign"), []byte("CF_Key\x00sig"))
+	writeTestFile(t, filepath.Join(dir, "Keys", "CF_Key.bikey"), []byte("CF_Key\x00key"))
+}
+
+func TestValidateMod(t *testing.T) {
+	dir := t.TempDir()
+	writeSignedMod(t, dir)
+	if err := ValidateMod(dir, ValidateOptions{}); err != nil {
+		t.Fatalf("expected valid mod, got %v", err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "Addons", "cf.pbo.CF_Key.bisign"), []byte("Other\x00sig"))
+	err := ValidateMod(dir, ValidateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no .bisign matches") {
+		t.Fatalf("expected signature mismatch, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "Addons", "cf.pbo.CF_Key.bisign")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "Addons", "broken.pbo"), []byte("broken"))
+	err = ValidateMod(dir, ValidateOptions{})
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Fatalf("expected two problems, got %v", err)
+	}
+	if !strings.Contains(verr.Problems[0], "Addons/broken.pbo: unreadable header") || !strings.Contains(verr.Problems[1], "Addons/cf.pbo: missing .bisign") {
+		t.Fatalf("unexpected problems: %q", verr.Problems)
+	}
+}
+
+func TestValidateModAllowUnsigned(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "addons", "server.pbo"), buildPBO(nil, []testFile{{name: "config.cpp", data: "x"}}))
+	if err := ValidateMod(dir, ValidateOptions{}); err == nil || !strings.Contains(err.Error(), "no .bikey") {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+	if err := ValidateMod(dir, ValidateOptions{AllowUnsigned: true}); err != nil {
+		t.Fatalf("expected unsigned mod to pass, got %v", err)
+	}
+}
+
+func TestValidateModRequiresPBOs(t *testing.T) {
+	dir := t.TempDir()
+	if err := ValidateMod(dir, ValidateOptions{}); err == nil || err.Error() != "missing addons folder" {
+		t.Fatalf("expected missing addons error, got %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "addons"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateMod(dir, ValidateOptions{}); err == nil || err.Error() != "no .pbo files in addons folder" {
+		t.Fatalf("expected missing pbo error, got %v", err)
+	}
+}
+
+// lzssABC is "abcabcabc": three literals and one back reference (distance 3,
+// length 6), followed by the additive checksum 882.
+const lzssABC = "\x07abc\x03\x03\x72\x03\x00\x00"
+
+func TestDecompressLZSS(t *testing.T) {
+	out, err := decompressLZSS([]byte(lzssABC), 9)
+	if err != nil || string(out) != "abcabcabc" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	out, err = decompressLZSS([]byte("\x00\x05\x00\x60\x00\x00\x00"), 3)
+	if err != nil || string(out) != "   " {
+		t.Fatalf("expected references before the start to yield spaces, got %q, %v", out, err)
+	}
+	if _, err := decompressLZSS([]byte("\x07abc\x03\x03\x00\x00\x00\x00"), 9); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+}
+
+func TestArchiveReadFile(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "cf.pbo")
+	writeTestFile(t, p, buildPBO([]Property{{Key: "prefix", Value: "cf"}}, []testFile{
+		{name: "config.cpp", data: "class CfgPatches {};"},
+		{name: `scripts\abc.c`, data: lzssABC, originalSize: 9},
+	}))
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if a.Prefix() != "cf" || a.Product() != "" {
+		t.Fatalf("unexpected properties: %#v", a.Properties)
+	}
+	files := a.Files()
+	if len(files) != 2 || files[1].Offset != files[0].Offset+20 || !files[1].Compressed() || files[0].Compressed() {
+		t.Fatalf("unexpected file table: %#v", files)
+	}
+	if b, err := a.ReadFile("CONFIG.CPP"); err != nil || string(b) != "class CfgPatches {};" {
+		t.Fatalf("read config.cpp: %q, %v", b, err)
+	}
+	if b, err := a.ReadFile("scripts/abc.c"); err != nil || string(b) != "abcabcabc" {
+		t.Fatalf("read compressed file: %q, %v", b, err)
+	}
+	if _, err := a.ReadFile("missing.c"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist, got %v", err)
+	}
+}
+
+func TestInspectMod(t *testing.T) {
+	dir := t.TempDir()
+	writeSignedMod(t, dir)
+	writeTestFile(t, filepath.Join(dir, "Addons", "extra.pbo"), buildPBO(nil, []testFile{{name: "data.bin", data: "1234"}}))
+	writeTestFile(t, filepath.Join(dir, "Addons", "extra.pbo.Other.bisign"), []byte("Other\x00sig"))
+
+	report, err := InspectMod(dir, InspectOptions{Files: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Keys) != 1 || report.Keys[0].Authority != "CF_Key" || report.Keys[0].File != "CF_Key.bikey" {
+		t.Fatalf("unexpected keys: %#v", report.Keys)
+	}
+	if !strings.Contains(report.ValidationError, "Addons/extra.pbo: no .bisign matches") {
+		t.Fatalf("unexpected validation error: %q", report.ValidationError)
+	}
+	if len(report.PBOs) != 2 {
+		t.Fatalf("unexpected pbos: %#v", report.PBOs)
+	}
+	cf, extra := report.PBOs[0], report.PBOs[1]
+	if cf.File != "cf.pbo" || cf.Prefix != "cf" || cf.Config != "config.cpp" || len(cf.Files) != 1 || cf.Error != "" {
+		t.Fatalf("unexpected cf.pbo report: %#v", cf)
+	}
+	if len(cf.Signatures) != 1 || !cf.Signatures[0].KnownKey {
+		t.Fatalf("expected known signature for cf.pbo: %#v", cf.Signatures)
+	}
+	if extra.Config != "" || len(extra.Signatures) != 1 || extra.Signatures[0].KnownKey || extra.Signatures[0].Authority != "Other" {
+		t.Fatalf("unexpected extra.pbo report: %#v", extra)
+	}
+
+	name, data, err := ExtractConfig(filepath.Join(report.Addons, "cf.pbo"))
+	if err != nil || name != "config.cpp" || string(data) != "x" {
+		t.Fatalf("extract config: %q %q %v", name, data, err)
+	}
+	if _, _, err := ExtractConfig(filepath.Join(report.Addons, "extra.pbo")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist for pbo without config, got %v", err)
+	}
+}
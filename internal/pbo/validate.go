@@ -0,0 +1,180 @@
+package pbo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValidateOptions relaxes ValidateMod for mods that ship without signatures.
+type ValidateOptions struct {
+	AllowUnsigned bool
+}
+
+// ValidationError lists every problem ValidateMod found.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// ValidateMod checks that a mod folder looks complete: addons/ holds at least
+// one .pbo, every PBO header is readable and not truncated, and every PBO has
+// a .bisign whose authority matches one of the mod's .bikey files.
+func ValidateMod(dir string, opts ValidateOptions) error {
+	var problems []string
+	addons, ok, err := findDir(dir, "addons")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ValidationError{Problems: []string{"missing addons folder"}}
+	}
+	pbos, signatures, err := scanAddons(addons)
+	if err != nil {
+		return err
+	}
+	if len(pbos) == 0 {
+		return &ValidationError{Problems: []string{"no .pbo files in addons folder"}}
+	}
+
+	keys, err := ModKeys(dir)
+	if err != nil {
+		return err
+	}
+	checkSignatures := !opts.AllowUnsigned
+	if checkSignatures && len(keys) == 0 {
+		problems = append(problems, "no .bikey in keys folder")
+		checkSignatures = false
+	}
+
+	for _, name := range pbos {
+		rel := filepath.Base(addons) + "/" + name
+		if _, err := ReadHeaderFile(filepath.Join(addons, name)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: unreadable header: %v", rel, err))
+			continue
+		}
+		if !checkSignatures {
+			continue
+		}
+		if problem := checkSignature(addons, rel, signatures[strings.ToLower(name)], keys); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// scanAddons lists the PBOs in an addons folder, sorted, and groups the
+// .bisign files by the lower-cased PBO name they sign.
+func scanAddons(addons string) ([]string, map[string][]string, error) {
+	entries, err := os.ReadDir(addons)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pbos []string
+	signatures := map[string][]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasSuffix(lower, ".pbo"):
+			pbos = append(pbos, name)
+		case strings.HasSuffix(lower, ".bisign"):
+			if i := strings.Index(lower, ".pbo."); i >= 0 {
+				signatures[lower[:i+4]] = append(signatures[lower[:i+4]], name)
+			}
+		}
+	}
+	sort.Strings(pbos)
+	return pbos, signatures, nil
+}
+
+// ModKeys returns the authority names of the .bikey files in the mod's keys
+// (or key) folder, mapped to their file names.
+func ModKeys(dir string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, name := range []string{"keys", "key"} {
+		keyDir, ok, err := findDir(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		entries, err := os.ReadDir(keyDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".bikey") {
+				continue
+			}
+			authority, err := ReadAuthority(filepath.Join(keyDir, e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", e.Name(), err)
+			}
+			keys[authority] = e.Name()
+		}
+	}
+	return keys, nil
+}
+
+// ReadAuthority returns the signing authority name that .bikey and .bisign
+// files start with.
+func ReadAuthority(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	name, err := readCString(&countingReader{r: bufio.NewReader(f)})
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("empty authority name")
+	}
+	return name, nil
+}
+
+func checkSignature(addons, rel string, signatures []string, keys map[string]string) string {
+	if len(signatures) == 0 {
+		return rel + ": missing .bisign"
+	}
+	for _, sig := range signatures {
+		authority, err := ReadAuthority(filepath.Join(addons, sig))
+		if err != nil {
+			continue
+		}
+		if _, ok := keys[authority]; ok {
+			return ""
+		}
+	}
+	return rel + ": no .bisign matches the mod's .bikey"
+}
+
+// findDir looks up a direct child directory of dir, ignoring case.
+func findDir(dir, name string) (string, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.EqualFold(e.Name(), name) {
+			return filepath.Join(dir, e.Name()), true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,13 @@ import (
 	battleye "github.com/multiplay/go-battleye"
 )
 
+// emptyPlaceholderPatterns match a placeholder together with the brackets
+// around it and the whitespace before, so an empty value leaves no "()".
+var emptyPlaceholderPatterns = map[string]*regexp.Regexp{
+	"{changes}":   regexp.MustCompile(`\s*(\(\s*\{changes\}\s*\)|\[\s*\{changes\}\s*\]|\{changes\})`),
+	"{changelog}": regexp.MustCompile(`\s*(\(\s*\{changelog\}\s*\)|\[\s*\{changelog\}\s*\]|\{changelog\})`),
+}
+
 type dialFn func(address, password string) (commandClient, error)
 
 type commandClient interface {
@@ -55,6 +63,11 @@ func (c *Controller) Tick(ctx context.Context, now time.Time, st *state.State) {
 			return
 		default:
 		}
+		if serverState.NeedsModUpdate && serverState.ShutdownDeadlineAt != nil && !now.Before(*serverState.ShutdownDeadlineAt) {
+			if c.deferShutdown(serverCfg.ID, serverState, now) {
+				continue
+			}
+		}
 
 		address := fmt.Sprintf("%s:%d", serverCfg.RCON.Host, serverCfg.RCON.Port)
 		client, err := c.dial(address, serverCfg.RCON.Password)
@@ -64,10 +77,24 @@ func (c *Controller) Tick(ctx context.Context, now time.Time, st *state.State) {
 			continue
 		}
 
+		changes := FormatChanges(serverState.PendingChanges, st.Mods)
+		changelog := FormatChangelog(serverState.UpdatedMods, st.Mods, c.cfg.Shutdown.ChangelogMaxChars)
 		if serverState.ShutdownDeadlineAt != nil && now.Before(*serverState.ShutdownDeadlineAt) {
+			if serverState.CountdownNotice != "" {
+				remaining := RemainingMinutes(*serverState.ShutdownDeadlineAt, now)
+				if template := c.noticeTemplate(serverState.CountdownNotice); template != "" {
+					if err := exec(client, sayCommand(withChanges(FormatMessage(template, remaining), changes, changelog))); err != nil {
+						c.logf("rcon countdown notice failed for server %s: %v", serverCfg.ID, err)
+					} else {
+						serverState.CountdownNotice = ""
+					}
+				} else {
+					serverState.CountdownNotice = ""
+				}
+			}
 			if shouldAnnounce(now, serverState.NextAnnounceAt) {
 				remaining := RemainingMinutes(*serverState.ShutdownDeadlineAt, now)
-				message := FormatMessage(c.cfg.Shutdown.MessageTemplate, remaining)
+				message := withChanges(FormatMessage(c.cfg.Shutdown.MessageTemplate, remaining), changes, changelog)
 				if err := exec(client, sayCommand(message)); err != nil {
 					c.logf("rcon announce failed for server %s: %v", serverCfg.ID, err)
 				} else {
@@ -76,13 +103,16 @@ func (c *Controller) Tick(ctx context.Context, now time.Time, st *state.State) {
 				}
 			}
 		} else {
-			if err := exec(client, sayCommand(c.cfg.Shutdown.FinalMessage)); err != nil {
+			if err := exec(client, sayCommand(withChanges(c.cfg.Shutdown.FinalMessage, changes, changelog))); err != nil {
 				c.logf("rcon final message failed for server %s: %v", serverCfg.ID, err)
 			}
 			if err := exec(client, "#shutdown"); err != nil {
 				c.logf("rcon shutdown failed for server %s: %v", serverCfg.ID, err)
 			} else {
 				serverState.NeedsShutdown = false
+				serverState.CountdownNotice = ""
+				serverState.PendingChanges = nil
+				serverState.UpdatedMods = nil
 				serverState.Stage = state.StageIdle
 				n := now.UTC()
 				serverState.ShutdownSentAt = &n
@@ -96,6 +126,35 @@ func (c *Controller) Tick(ctx context.Context, now time.Time, st *state.State) {
 	}
 }
 
+// deferShutdown reports whether #shutdown waits for a pending mod sync. It
+// does not wait for a sync that failed, nor longer than
+// shutdown.max_defer_seconds past the deadline.
+func (c *Controller) deferShutdown(serverID string, srv state.ServerState, now time.Time) bool {
+	if srv.Stage == state.StageError {
+		c.logf("rcon shutdown not deferred for server %s: mod sync failed: %s", serverID, srv.LastError)
+		return false
+	}
+	maxDefer := time.Duration(c.cfg.Shutdown.MaxDeferSeconds) * time.Second
+	if maxDefer > 0 && !now.Before(srv.ShutdownDeadlineAt.Add(maxDefer)) {
+		c.logf("rcon shutdown deferred too long for server %s: restarting with mod sync still pending", serverID)
+		return false
+	}
+	c.logf("rcon shutdown deferred for server %s: mod sync still pending", serverID)
+	return true
+}
+
+func (c *Controller) noticeTemplate(notice state.CountdownNotice) string {
+	switch notice {
+	case state.CountdownNoticeRestarted:
+		return c.cfg.Shutdown.RestartedMessage
+	case state.CountdownNoticeExtended:
+		return c.cfg.Shutdown.ExtendedMessage
+	case state.CountdownNoticeMerged:
+		return c.cfg.Shutdown.MergedMessage
+	}
+	return ""
+}
+
 func RemainingMinutes(deadline, now time.Time) int {
 	if !deadline.After(now) {
 		return 0
@@ -108,6 +167,68 @@ func FormatMessage(template string, minutes int) string {
 	return strings.ReplaceAll(template, "{minutes}", strconv.Itoa(minutes))
 }
 
+// FormatChanges renders pending modlist changes as "added: A, B; removed: C"
+// using display names where known. It returns "" when nothing changed.
+func FormatChanges(changes *state.ModsetChanges, mods map[string]state.ModState) string {
+	if changes == nil {
+		return ""
+	}
+	parts := make([]string, 0, 2)
+	if len(changes.Added) > 0 {
+		parts = append(parts, "added: "+strings.Join(modNames(changes.Added, mods), ", "))
+	}
+	if len(changes.Removed) > 0 {
+		parts = append(parts, "removed: "+strings.Join(modNames(changes.Removed, mods), ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func modNames(ids []string, mods map[string]state.ModState) []string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, modName(id, mods))
+	}
+	return names
+}
+
+func modName(id string, mods map[string]state.ModState) string {
+	if name := mods[id].DisplayName; name != "" {
+		return name
+	}
+	return id
+}
+
+// FormatChangelog summarizes the changelogs of the updated mods as
+// "A: first line; B: first line", cut to maxChars. It returns "" when none of
+// the mods has a changelog.
+func FormatChangelog(updated []string, mods map[string]state.ModState, maxChars int) string {
+	parts := make([]string, 0, len(updated))
+	for _, id := range updated {
+		text := mods[id].Changelog
+		if text == "" {
+			continue
+		}
+		text, _, _ = strings.Cut(text, "\n")
+		parts = append(parts, modName(id, mods)+": "+text)
+	}
+	summary := strings.Join(parts, "; ")
+	if runes := []rune(summary); maxChars > 0 && len(runes) > maxChars {
+		summary = strings.TrimSpace(string(runes[:max(maxChars-3, 0)])) + "..."
+	}
+	return summary
+}
+
+// withChanges fills in {changes} and {changelog}. An empty value drops the
+// placeholder with its surrounding brackets and leading whitespace.
+func withChanges(message, changes, changelog string) string {
+	for placeholder, value := range map[string]string{"{changes}": changes, "{changelog}": changelog} {
+		if value == "" {
+			message = emptyPlaceholderPatterns[placeholder].ReplaceAllString(message, "")
+		}
+	}
+	return strings.NewReplacer("{changes}", changes, "{changelog}", changelog).Replace(message)
+}
+
 func shouldAnnounce(now time.Time, next *time.Time) bool {
 	return next == nil || !now.Before(*next)
 }
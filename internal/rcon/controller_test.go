@@ -102,6 +102,57 @@ func TestTickKeepsNeedsShutdownOnConnectError(t *testing.T) {
 	}
 }
 
+func TestTickAnnouncesCountdownNoticeOnce(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(3 * time.Minute)
+	next := now.Add(time.Minute)
+	stateData := state.State{Servers: map[string]state.ServerState{"s1": {
+		NeedsShutdown:      true,
+		Stage:              state.StageCountdown,
+		ShutdownDeadlineAt: &deadline,
+		NextAnnounceAt:     &next,
+		CountdownNotice:    state.CountdownNoticeExtended,
+	}}}
+	fake := &fakeRCONClient{}
+	controller := NewController(testConfig()).WithLogger(t.Logf)
+	controller.dial = func(address, password string) (commandClient, error) { return fake, nil }
+
+	controller.Tick(context.Background(), now, &stateData)
+	if len(fake.commands) != 1 || fake.commands[0] != "say -1 Restart postponed, 3 minutes left" {
+		t.Fatalf("unexpected notice commands: %+v", fake.commands)
+	}
+	if stateData.Servers["s1"].CountdownNotice != "" {
+		t.Fatalf("expected countdown notice to be cleared")
+	}
+
+	fake.commands = nil
+	controller.Tick(context.Background(), now.Add(time.Second), &stateData)
+	if len(fake.commands) != 0 {
+		t.Fatalf("expected notice to be sent once, got %+v", fake.commands)
+	}
+}
+
+func TestTickDefersShutdownWhileSyncPending(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(-time.Second)
+	stateData := state.State{Servers: map[string]state.ServerState{"s1": {
+		NeedsShutdown:      true,
+		NeedsModUpdate:     true,
+		Stage:              state.StageSyncing,
+		ShutdownDeadlineAt: &deadline,
+	}}}
+	controller := NewController(testConfig()).WithLogger(t.Logf)
+	controller.dial = func(address, password string) (commandClient, error) {
+		t.Fatalf("rcon should not connect while sync is pending")
+		return nil, nil
+	}
+
+	controller.Tick(context.Background(), now, &stateData)
+	if !stateData.Servers["s1"].NeedsShutdown {
+		t.Fatalf("expected needs_shutdown to remain true while sync is pending")
+	}
+}
+
 type fakeRCONClient struct {
 	commands []string
 }
@@ -121,6 +172,7 @@ func testConfig() config.Config {
 			AnnounceEverySeconds: 30,
 			MessageTemplate:      "Restart in {minutes} minutes",
 			FinalMessage:         "Server shutting down now",
+			ExtendedMessage:      "Restart postponed, {minutes} minutes left",
 		},
 		Servers: []config.ServerConfig{{
 			ID: "s1",
@@ -136,3 +188,96 @@ func testConfig() config.Config {
 func (f *fakeRCONClient) String() string {
 	return fmt.Sprintf("%v", f.commands)
 }
+
+func TestFormatChangesUsesDisplayNames(t *testing.T) {
+	mods := map[string]state.ModState{"1": {DisplayName: "CF"}, "3": {DisplayName: "Trader"}}
+	got := FormatChanges(&state.ModsetChanges{Added: []string{"1", "2"}, Removed: []string{"3"}}, mods)
+	if got != "added: CF, 2; removed: Trader" {
+		t.Fatalf("unexpected changes summary: %q", got)
+	}
+	if FormatChanges(nil, mods) != "" {
+		t.Fatalf("expected empty summary without changes")
+	}
+	if msg := withChanges("Restart ({changes})", got, ""); msg != "Restart (added: CF, 2; removed: Trader)" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+	for template, want := range map[string]string{
+		"Restart in 5 min ({changes})":           "Restart in 5 min",
+		"Restart in 5 min [ {changes} ], bye":    "Restart in 5 min, bye",
+		"Restart {changes} in 5 min {changelog}": "Restart in 5 min",
+	} {
+		if msg := withChanges(template, "", ""); msg != want {
+			t.Fatalf("withChanges(%q) = %q, want %q", template, msg, want)
+		}
+	}
+}
+
+func TestFormatChangelogSummarizesUpdatedMods(t *testing.T) {
+	mods := map[string]state.ModState{
+		"1": {DisplayName: "CF", Changelog: "Fixed crash on login\nMinor tweaks"},
+		"2": {Changelog: "New weapons"},
+		"3": {DisplayName: "Trader"},
+	}
+	if got := FormatChangelog([]string{"1", "2", "3"}, mods, 0); got != "CF: Fixed crash on login; 2: New weapons" {
+		t.Fatalf("unexpected changelog summary: %q", got)
+	}
+	if got := FormatChangelog([]string{"1", "2"}, mods, 20); got != "CF: Fixed crash o..." {
+		t.Fatalf("unexpected truncated summary: %q", got)
+	}
+	if FormatChangelog([]string{"3"}, mods, 20) != "" {
+		t.Fatalf("expected empty summary without changelogs")
+	}
+}
+
+func TestTickFinalMessageIncludesChangelog(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(-time.Second)
+	stateData := state.State{
+		Mods: map[string]state.ModState{"1": {DisplayName: "CF", Changelog: "Fixed crash"}},
+		Servers: map[string]state.ServerState{"s1": {
+			NeedsShutdown:      true,
+			Stage:              state.StageCountdown,
+			ShutdownDeadlineAt: &deadline,
+			UpdatedMods:        []string{"1"},
+		}},
+	}
+	cfg := testConfig()
+	cfg.Shutdown.FinalMessage = "Restarting now ({changelog})"
+	fake := &fakeRCONClient{}
+	controller := NewController(cfg).WithLogger(t.Logf)
+	controller.dial = func(address, password string) (commandClient, error) { return fake, nil }
+
+	controller.Tick(context.Background(), now, &stateData)
+	if len(fake.commands) != 2 || fake.commands[0] != "say -1 Restarting now (CF: Fixed crash)" {
+		t.Fatalf("unexpected commands: %+v", fake.commands)
+	}
+	if stateData.Servers["s1"].UpdatedMods != nil {
+		t.Fatalf("expected updated mods to be cleared after shutdown")
+	}
+}
+
+func TestTickStopsDeferringShutdown(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for name, srv := range map[string]state.ServerState{
+		"sync failed":       {Stage: state.StageError, LastError: "mod 1 step sync mod: boom", ShutdownDeadlineAt: ptrTime(now.Add(-time.Second))},
+		"deferred too long": {Stage: state.StageSyncing, ShutdownDeadlineAt: ptrTime(now.Add(-11 * time.Minute))},
+	} {
+		srv.NeedsShutdown = true
+		srv.NeedsModUpdate = true
+		stateData := state.State{Servers: map[string]state.ServerState{"s1": srv}}
+		cfg := testConfig()
+		cfg.Shutdown.MaxDeferSeconds = 600
+		fake := &fakeRCONClient{}
+		controller := NewController(cfg).WithLogger(t.Logf)
+		controller.dial = func(address, password string) (commandClient, error) { return fake, nil }
+
+		controller.Tick(context.Background(), now, &stateData)
+		if len(fake.commands) != 2 || fake.commands[1] != "#shutdown" || stateData.Servers["s1"].NeedsShutdown {
+			t.Fatalf("%s: expected shutdown, got %+v", name, fake.commands)
+		}
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
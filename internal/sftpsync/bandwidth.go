@@ -0,0 +1,130 @@
+package sftpsync
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+)
+
+const throttleChunkSize = 32 << 10
+
+// rateLimiter is a token bucket refilled at the limit active for the current
+// time of day, with a burst of one second worth of bytes. Callers may go into
+// debt and then sleep it off, so any read size works with any rate. A nil
+// limiter never blocks.
+type rateLimiter struct {
+	mu     sync.Mutex
+	cfg    config.BandwidthConfig
+	now    func() time.Time
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(cfg config.BandwidthConfig) *rateLimiter {
+	if cfg.MaxBytesPerSecond == 0 && len(cfg.QuietHours) == 0 {
+		return nil
+	}
+	return &rateLimiter{cfg: cfg, now: time.Now}
+}
+
+// limitAt returns the bytes-per-second cap at t, 0 meaning unlimited.
+func limitAt(cfg config.BandwidthConfig, t time.Time) int64 {
+	local := t.Local()
+	minute := local.Hour()*60 + local.Minute()
+	for _, window := range cfg.QuietHours {
+		start, err := config.ParseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := config.ParseClock(window.End)
+		if err != nil {
+			continue
+		}
+		inside := minute >= start && minute < end
+		if end <= start {
+			inside = minute >= start || minute < end
+		}
+		if inside {
+			return window.MaxBytesPerSecond
+		}
+	}
+	return cfg.MaxBytesPerSecond
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	rate := float64(limitAt(l.cfg, now))
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		l.mu.Unlock()
+		return nil
+	}
+	if l.last.IsZero() {
+		l.tokens = rate
+	} else if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * rate
+	}
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledReader charges every read against all limiters, e.g. the global
+// bucket shared by every server and the bucket of one server.
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func throttle(ctx context.Context, r io.Reader, limiters []*rateLimiter) io.Reader {
+	active := make([]*rateLimiter, 0, len(limiters))
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiters: active}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := t.r.Read(p)
+	for _, l := range t.limiters {
+		if werr := l.wait(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,269 @@
+package sftpsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	remoteManifestName   = ".dayzmods-manifest.json"
+	sha256sumBatchSize   = 64
+	localHashCacheFormat = 1
+)
+
+type manifestEntry struct {
+	Size   int64  `json:"size"`
+	MTime  int64  `json:"mtime"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type remoteManifest struct {
+	Version     int                      `json:"version"`
+	GeneratedAt time.Time                `json:"generated_at"`
+	ModVersion  time.Time                `json:"mod_version"`
+	Dirs        []string                 `json:"dirs"`
+	Files       map[string]manifestEntry `json:"files"`
+}
+
+type localHashCache struct {
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+}
+
+// hashLocalTree fills Hash for every file in tree, reusing cached digests whose
+// size and mtime still match and persisting the refreshed cache to cachePath
+// (skipped when cachePath is empty).
+func hashLocalTree(root string, tree map[string]treeEntry, cachePath string) error {
+	cache := localHashCache{Version: localHashCacheFormat, Files: map[string]manifestEntry{}}
+	if b, err := os.ReadFile(cachePath); cachePath != "" && err == nil {
+		var loaded localHashCache
+		if json.Unmarshal(b, &loaded) == nil && loaded.Version == localHashCacheFormat && loaded.Files != nil {
+			cache = loaded
+		}
+	}
+
+	fresh := make(map[string]manifestEntry, len(tree))
+	for rel, entry := range tree {
+		if entry.IsDir {
+			continue
+		}
+		cached, ok := cache.Files[rel]
+		if !ok || cached.Size != entry.Size || cached.MTime != entry.MTime || cached.SHA256 == "" {
+			sum, err := hashFile(filepath.Join(root, filepath.FromSlash(rel)))
+			if err != nil {
+				return fmt.Errorf("hash %s: %w", rel, err)
+			}
+			cached = manifestEntry{Size: entry.Size, MTime: entry.MTime, SHA256: sum}
+		}
+		entry.Hash = cached.SHA256
+		tree[rel] = entry
+		fresh[rel] = cached
+	}
+	if cachePath == "" {
+		return nil
+	}
+	cache.Files = fresh
+	return writeJSONAtomic(cachePath, cache)
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeJSONAtomic(p string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, p)
+}
+
+func readRemoteManifest(client *sftp.Client, remoteModPath string) (remoteManifest, bool) {
+	f, err := client.Open(path.Join(remoteModPath, remoteManifestName))
+	if err != nil {
+		return remoteManifest{}, false
+	}
+	defer f.Close()
+	var manifest remoteManifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil || manifest.Files == nil {
+		return remoteManifest{}, false
+	}
+	return manifest, true
+}
+
+func writeRemoteManifest(client *sftp.Client, remoteModPath string, manifest remoteManifest) error {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	final := path.Join(remoteModPath, remoteManifestName)
+	tmpPath := final + fmt.Sprintf(".tmp-%d", time.Now().UnixNano())
+	dst, err := client.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, bytes.NewReader(b)); err != nil {
+		dst.Close()
+		_ = client.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = client.Remove(tmpPath)
+		return err
+	}
+	_ = client.Remove(final)
+	if err := client.Rename(tmpPath, final); err != nil {
+		_ = client.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// reuseManifestHashes copies the digests of an earlier manifest to files
+// whose size and mtime are unchanged, so a manifest written without hashing
+// keeps the hashes it already had.
+func reuseManifestHashes(tree map[string]treeEntry, manifest remoteManifest) {
+	for rel, entry := range tree {
+		m, ok := manifest.Files[rel]
+		if !ok || entry.IsDir || entry.Hash != "" || m.Size != entry.Size || m.MTime != entry.MTime {
+			continue
+		}
+		entry.Hash = m.SHA256
+		tree[rel] = entry
+	}
+}
+
+func manifestFromTree(tree map[string]treeEntry, version, now time.Time) remoteManifest {
+	files := make(map[string]manifestEntry, len(tree))
+	dirs := make([]string, 0)
+	for rel, entry := range tree {
+		if entry.IsDir {
+			dirs = append(dirs, rel)
+			continue
+		}
+		files[rel] = manifestEntry{Size: entry.Size, MTime: entry.MTime, SHA256: entry.Hash}
+	}
+	sort.Strings(dirs)
+	return remoteManifest{Version: 1, GeneratedAt: now.UTC(), ModVersion: version.UTC(), Dirs: dirs, Files: files}
+}
+
+func (m remoteManifest) tree() map[string]treeEntry {
+	tree := make(map[string]treeEntry, len(m.Dirs)+len(m.Files))
+	for _, dir := range m.Dirs {
+		tree[dir] = treeEntry{Path: dir, IsDir: true}
+	}
+	for rel, f := range m.Files {
+		mt := time.Unix(f.MTime, 0).UTC()
+		tree[rel] = treeEntry{Path: rel, Size: f.Size, MTime: f.MTime, ModTime: mt, Hash: f.SHA256}
+	}
+	return tree
+}
+
+// applyRemoteHashes attaches digests to remote files. Manifest entries are only
+// trusted while the remote size and mtime still match; the rest are hashed with
+// sha256sum over SSH exec when sshClient is non-nil.
+func applyRemoteHashes(remoteTree map[string]treeEntry, manifest remoteManifest, sshClient *ssh.Client, remoteModPath string) error {
+	missing := make([]string, 0)
+	for rel, entry := range remoteTree {
+		if entry.IsDir {
+			continue
+		}
+		if m, ok := manifest.Files[rel]; ok && m.Size == entry.Size && m.MTime == entry.MTime {
+			entry.Hash = m.SHA256
+			remoteTree[rel] = entry
+			continue
+		}
+		missing = append(missing, rel)
+	}
+	if sshClient == nil || len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	for start := 0; start < len(missing); start += sha256sumBatchSize {
+		end := start + sha256sumBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		sums, err := remoteSHA256(sshClient, remoteModPath, missing[start:end])
+		if err != nil {
+			return err
+		}
+		for rel, sum := range sums {
+			if entry, ok := remoteTree[rel]; ok {
+				entry.Hash = sum
+				remoteTree[rel] = entry
+			}
+		}
+	}
+	return nil
+}
+
+func remoteSHA256(sshClient *ssh.Client, remoteModPath string, rels []string) (map[string]string, error) {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("open ssh session: %w", err)
+	}
+	defer session.Close()
+	args := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		args = append(args, shellQuote(rel))
+	}
+	out, err := session.Output(fmt.Sprintf("cd %s && sha256sum -- %s", shellQuote(remoteModPath), strings.Join(args, " ")))
+	if err != nil {
+		return nil, fmt.Errorf("remote sha256sum: %w", err)
+	}
+	return parseSHA256SumOutput(string(out)), nil
+}
+
+func parseSHA256SumOutput(out string) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		name = strings.TrimPrefix(name, " ")
+		name = strings.TrimPrefix(name, "*")
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,54 @@
+package sftpsync
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
+	"github.com/pkg/sftp"
+)
+
+const statVFSExtension = "statvfs@openssh.com"
+
+// errRemoteSpaceUnknown marks a preflight that could not read the remote free
+// space. The sync goes ahead and the engine logs it once per server.
+var errRemoteSpaceUnknown = errors.New("remote free space unknown")
+
+// checkRemoteSpace runs before a mod's first remote change. Uploads go to a
+// temp file that is renamed over the old one, so the full size of every
+// upload is required. Servers without the statvfs extension, or whose statvfs
+// fails, return errRemoteSpaceUnknown.
+func checkRemoteSpace(client *sftp.Client, remoteModPath string, rootExists bool, uploads []treeEntry) error {
+	var required uint64
+	for _, file := range uploads {
+		required += uint64(file.Size)
+	}
+	if required == 0 {
+		return nil
+	}
+	if _, ok := client.HasExtension(statVFSExtension); !ok {
+		return fmt.Errorf("%w: server lacks %s", errRemoteSpaceUnknown, statVFSExtension)
+	}
+	target := remoteModPath
+	if !rootExists {
+		target = path.Dir(remoteModPath)
+	}
+	vfs, err := client.StatVFS(target)
+	if err != nil {
+		return fmt.Errorf("%w: statvfs %s: %w", errRemoteSpaceUnknown, target, err)
+	}
+	return remoteSpaceError(vfs, remoteModPath, required)
+}
+
+func remoteSpaceError(vfs *sftp.StatVFS, remoteModPath string, required uint64) error {
+	blockSize := vfs.Frsize
+	if blockSize == 0 {
+		blockSize = vfs.Bsize
+	}
+	available := vfs.Bavail * blockSize
+	if available >= required {
+		return nil
+	}
+	return &diskspace.InsufficientSpaceError{Path: remoteModPath, Required: required, Available: available}
+}
@@ -9,12 +9,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
+	"github.com/example/dayz-standalone-mode-updater/internal/sshpool"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -23,6 +26,7 @@ import (
 type Engine struct {
 	now    func() time.Time
 	logger *slog.Logger
+	pool   *sshpool.Pool
 }
 
 type treeEntry struct {
@@ -31,14 +35,35 @@ type treeEntry struct {
 	Size    int64
 	MTime   int64
 	ModTime time.Time
+	Hash    string
+}
+
+type modSyncOptions struct {
+	rules           syncRules
+	checksum        bool
+	hashCachePath   string
+	sshClient       *ssh.Client
+	writeManifest   bool
+	trustManifest   bool
+	expectVersion   time.Time
+	manifestVersion time.Time
+	journal         *uploadJournal
+	resume          bool
+	uploadClients   []*sftp.Client
+	fileWorkers     int
+	bandwidth       []*rateLimiter
 }
 
 type syncPlan struct {
 	deleteTypeConflicts []treeEntry
 	mkdirs              []treeEntry
 	uploads             []treeEntry
+	touches             []treeEntry
 	deleteExtrasFiles   []treeEntry
 	deleteExtrasDirs    []treeEntry
+	remoteWalked        bool
+	createdRoot         bool
+	spaceUnknown        error
 }
 
 func NewEngine() *Engine {
@@ -52,15 +77,23 @@ func (e *Engine) WithLogger(logger *slog.Logger) *Engine {
 	return e
 }
 
+// WithPool makes the engine borrow pooled SSH/SFTP connections instead of
+// dialing a new one per server sync.
+func (e *Engine) WithPool(pool *sshpool.Pool) *Engine {
+	e.pool = pool
+	return e
+}
+
 func (e *Engine) SyncServers(ctx context.Context, cfg config.Config, st *state.State) error {
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, cfg.Concurrency.SFTPSyncParallelismServers)
 	errCh := make(chan error, len(cfg.Servers))
 	var mu sync.Mutex
+	global := newRateLimiter(cfg.Sync.Bandwidth)
 
 	for _, serverCfg := range cfg.Servers {
 		srv := st.Servers[serverCfg.ID]
-		if !srv.NeedsModUpdate {
+		if !srv.NeedsModUpdate && !deepVerifyDue(cfg, srv, e.now()) {
 			continue
 		}
 		serverCfg := serverCfg
@@ -78,7 +111,7 @@ func (e *Engine) SyncServers(ctx context.Context, cfg config.Config, st *state.S
 			srvState := st.Servers[serverCfg.ID]
 			mu.Unlock()
 
-			updated, err := e.syncServer(ctx, cfg, serverCfg, st.Mods, srvState)
+			updated, err := e.syncServer(ctx, cfg, serverCfg, st.Mods, srvState, global)
 			mu.Lock()
 			st.Servers[serverCfg.ID] = updated
 			mu.Unlock()
@@ -97,12 +130,21 @@ func (e *Engine) SyncServers(ctx context.Context, cfg config.Config, st *state.S
 	return errors.Join(errs...)
 }
 
-func (e *Engine) syncServer(ctx context.Context, cfg config.Config, server config.ServerConfig, mods map[string]state.ModState, srv state.ServerState) (state.ServerState, error) {
+func (e *Engine) syncServer(ctx context.Context, cfg config.Config, server config.ServerConfig, mods map[string]state.ModState, srv state.ServerState, global *rateLimiter) (state.ServerState, error) {
 	if srv.SyncedMods == nil {
 		srv.SyncedMods = map[string]time.Time{}
 	}
+	if srv.LastDeepVerifyAt == nil {
+		srv.LastDeepVerifyAt = map[string]time.Time{}
+	}
+	// A run without a pending update only deep verifies; it keeps the stage
+	// and starts a countdown only if it had to repair the remote tree.
+	updateRun := srv.NeedsModUpdate
+	prevStage := srv.Stage
 	srv.Stage = state.StageSyncing
 	modsToSync := make([]string, 0, len(srv.LastModIDs))
+	deepVerify := map[string]bool{}
+	deepVerifyEvery := time.Duration(cfg.Sync.DeepVerifyHours) * time.Hour
 	for _, id := range srv.LastModIDs {
 		mod, ok := mods[id]
 		if !ok {
@@ -117,41 +159,94 @@ func (e *Engine) syncServer(ctx context.Context, cfg config.Config, server confi
 			srv.LastErrorAt = &now
 			return srv, fmt.Errorf("mod %s local_updated_at is zero", id)
 		}
+		if mod.ValidationError != "" {
+			srv.Stage = state.StageError
+			srv.NeedsModUpdate = true
+			srv.LastError = fmt.Sprintf("mod %s failed content validation: %s", id, mod.ValidationError)
+			srv.LastErrorStage = "validate_content"
+			now := e.now()
+			srv.LastErrorAt = &now
+			return srv, fmt.Errorf("mod %s failed content validation", id)
+		}
 		if !mod.LocalUpdatedAt.Equal(srv.SyncedMods[id]) {
 			modsToSync = append(modsToSync, id)
+		} else if deepVerifyEvery > 0 && e.now().Sub(srv.LastDeepVerifyAt[id]) >= deepVerifyEvery {
+			deepVerify[id] = true
 		}
 	}
-	if len(modsToSync) == 0 {
-		srv.NeedsModUpdate = false
-		srv.NeedsShutdown = true
-		srv.Stage = state.StageCountdown
-		now := e.now()
-		deadline := now.Add(time.Duration(cfg.Shutdown.GracePeriodSeconds) * time.Second)
-		srv.ShutdownDeadlineAt = &deadline
-		srv.NextAnnounceAt = &now
+	for _, id := range srv.LastModIDs {
+		if deepVerify[id] {
+			modsToSync = append(modsToSync, id)
+		}
+	}
+	orphans := findOrphans(srv.OwnedRemoteFolders, srv.LastModIDs, mods)
+	if !cfg.Sync.DeleteOrphans {
+		for _, orphan := range orphans {
+			e.logger.Info("sftp orphan folder kept (dry run)", "server_id", server.ID, "mod_id", orphan.modID, "stage", "orphan_cleanup", "remote_path", path.Join(server.SFTP.RemoteModsRoot, orphan.slug))
+		}
+		orphans = nil
+	}
+	if len(modsToSync) == 0 && len(orphans) == 0 {
+		if updateRun {
+			startCountdown(&srv, cfg.Shutdown, e.now())
+		} else {
+			srv.Stage = prevStage
+		}
 		return srv, nil
 	}
 
+	journal, err := loadUploadJournal(filepath.Join(cfg.Paths.LocalCacheRoot, "servers", server.ID, "partial_uploads.json"), srv.PartialUploads)
+	if err != nil {
+		srv.Stage = state.StageError
+		recordSyncError(&srv, "sync_mod", "load upload journal", "", err, e.now)
+		return srv, err
+	}
 	connectStart := time.Now()
-	client, sshClient, err := dialSFTP(ctx, server)
+	clientOpts := ClientOptions(cfg.Sync)
+	lease, err := e.acquire(ctx, server)
 	if err != nil {
 		srv.Stage = state.StageError
-		srv.NeedsModUpdate = true
 		recordSyncError(&srv, "connect", "connect sftp", "", err, e.now)
 		e.logger.Error("sftp connect failed", "server_id", server.ID, "stage", "connect", "duration_ms", time.Since(connectStart).Milliseconds(), "error", err)
 		return srv, err
 	}
 	e.logger.Info("sftp connect ok", "server_id", server.ID, "stage", "connect", "duration_ms", time.Since(connectStart).Milliseconds())
-	defer sshClient.Close()
-	defer client.Close()
+	var leaseErr error
+	defer func() { lease.Release(leaseErr) }()
+	client, sshClient := lease.SFTP, lease.SSH
+	sessions := []*sftp.Client{client}
+	for len(sessions) < cfg.Sync.SFTPSessionsPerServer {
+		extra, err := sftp.NewClient(sshClient, clientOpts...)
+		if err != nil {
+			e.logger.Error("sftp extra session failed", "server_id", server.ID, "stage", "connect", "sessions", len(sessions), "error", err)
+			break
+		}
+		defer extra.Close()
+		sessions = append(sessions, extra)
+	}
+
+	bandwidth := []*rateLimiter{global, newRateLimiter(server.SFTP.Bandwidth)}
 
 	sem := make(chan struct{}, cfg.Concurrency.SFTPSyncParallelismModsPerServer)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	hadFailure := false
+	var connErr error
+	var spaceUnknownOnce sync.Once
+	changed := false
+	syncedBefore := make(map[string]time.Time, len(srv.SyncedMods))
+	for id, at := range srv.SyncedMods {
+		syncedBefore[id] = at
+	}
+	verifiedBefore := make(map[string]time.Time, len(srv.LastDeepVerifyAt))
+	for id, at := range srv.LastDeepVerifyAt {
+		verifiedBefore[id] = at
+	}
 	for _, id := range modsToSync {
 		id := id
 		mod := mods[id]
+		syncedAt := syncedBefore[id]
+		lastVerified := verifiedBefore[id]
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -167,37 +262,169 @@ func (e *Engine) syncServer(ctx context.Context, cfg config.Config, server confi
 			start := time.Now()
 			modCtx, cancel := context.WithTimeout(ctx, time.Duration(server.SFTP.OperationTimeoutSeconds)*time.Second)
 			defer cancel()
-			plan, err := syncMod(modCtx, client, local, remote)
+			opts := modSyncOptions{
+				rules:           newSyncRules(server.SFTP.Rules, cfg.Sync.ModRules[id]),
+				checksum:        cfg.Sync.CompareMode == config.CompareModeChecksum,
+				hashCachePath:   filepath.Join(cfg.Paths.LocalCacheRoot, "hashes", mod.FolderSlug+".json"),
+				writeManifest:   cfg.Sync.RemoteListing == config.RemoteListingManifest,
+				trustManifest:   cfg.Sync.RemoteListing == config.RemoteListingManifest && !deepVerify[id] && (deepVerifyEvery <= 0 || e.now().Sub(lastVerified) < deepVerifyEvery),
+				expectVersion:   syncedAt,
+				manifestVersion: mod.LocalUpdatedAt,
+				journal:         journal,
+				resume:          !cfg.Sync.UseConcurrentWrites,
+				uploadClients:   sessions,
+				fileWorkers:     cfg.Sync.FileWorkersPerMod,
+				bandwidth:       bandwidth,
+			}
+			if server.SFTP.AllowSSHExec {
+				opts.sshClient = sshClient
+			}
+			plan, err := syncMod(modCtx, client, local, remote, opts)
 			if err != nil {
+				stage := "sync_mod"
+				if diskspace.IsInsufficient(err) {
+					stage = "preflight_disk"
+				}
 				mu.Lock()
 				hadFailure = true
-				recordSyncError(&srv, "sync_mod", "sync mod", id, err, e.now)
+				if sshpool.ConnectionBroken(err) {
+					connErr = err
+				}
+				recordSyncError(&srv, stage, "sync mod", id, err, e.now)
 				mu.Unlock()
-				e.logger.Error("sftp sync mod failed", "server_id", server.ID, "mod_id", id, "stage", "sync_mod", "duration_ms", time.Since(start).Milliseconds(), "error", err)
+				e.logger.Error("sftp sync mod failed", "server_id", server.ID, "mod_id", id, "stage", stage, "duration_ms", time.Since(start).Milliseconds(), "error", err)
 				return
 			}
-			e.logger.Info("sftp sync mod completed", "server_id", server.ID, "mod_id", id, "stage", "sync_mod", "duration_ms", time.Since(start).Milliseconds(), "mkdir_count", len(plan.mkdirs), "upload_count", len(plan.uploads), "delete_count", len(plan.deleteTypeConflicts)+len(plan.deleteExtrasFiles)+len(plan.deleteExtrasDirs))
+			if plan.spaceUnknown != nil {
+				spaceUnknownOnce.Do(func() {
+					e.logger.Warn("sftp remote disk preflight skipped", "server_id", server.ID, "mod_id", id, "stage", "preflight_disk", "error", plan.spaceUnknown)
+				})
+			}
+			e.logger.Info("sftp sync mod completed", "server_id", server.ID, "mod_id", id, "stage", "sync_mod", "duration_ms", time.Since(start).Milliseconds(), "mkdir_count", len(plan.mkdirs), "upload_count", len(plan.uploads), "delete_count", len(plan.deleteTypeConflicts)+len(plan.deleteExtrasFiles)+len(plan.deleteExtrasDirs), "remote_walked", plan.remoteWalked)
 			mu.Lock()
+			if plan.changesRemote() {
+				changed = true
+			}
+			if prev := srv.SyncedMods[id]; !prev.IsZero() && !prev.Equal(mod.LocalUpdatedAt) && !slices.Contains(srv.UpdatedMods, id) {
+				srv.UpdatedMods = append(srv.UpdatedMods, id)
+			}
 			srv.SyncedMods[id] = mod.LocalUpdatedAt
+			if plan.createdRoot {
+				if srv.OwnedRemoteFolders == nil {
+					srv.OwnedRemoteFolders = map[string]string{}
+				}
+				srv.OwnedRemoteFolders[mod.FolderSlug] = id
+			}
+			if plan.remoteWalked {
+				srv.LastDeepVerifyAt[id] = e.now()
+			}
 			mu.Unlock()
 		}()
 	}
 	wg.Wait()
+	e.cleanupOrphans(ctx, client, cfg, server, &srv, orphans, journal)
+	srv.PartialUploads = journal.snapshot()
 
 	if hadFailure {
+		// Only a transport failure poisons the pooled connection; a full
+		// disk, a permission error or a bad local file does not.
+		leaseErr = connErr
 		srv.NeedsModUpdate = true
 		srv.Stage = state.StageError
 		return srv, fmt.Errorf("at least one mod failed to sync")
 	}
 	now := e.now()
+	if !updateRun && !changed {
+		srv.Stage = prevStage
+		return srv, nil
+	}
+	if !updateRun {
+		e.logger.Info("sftp deep verify repaired remote mods", "server_id", server.ID, "stage", "deep_verify")
+	}
+	startCountdown(&srv, cfg.Shutdown, now)
+	srv.LastSuccessSyncAt = &now
+	return srv, nil
+}
+
+// deepVerifyDue reports whether a synced mod of srv has not been walked for
+// sync.deep_verify_hours; the server is then synced without a pending update.
+func deepVerifyDue(cfg config.Config, srv state.ServerState, now time.Time) bool {
+	every := time.Duration(cfg.Sync.DeepVerifyHours) * time.Hour
+	if every <= 0 {
+		return false
+	}
+	for _, id := range srv.LastModIDs {
+		if !srv.SyncedMods[id].IsZero() && now.Sub(srv.LastDeepVerifyAt[id]) >= every {
+			return true
+		}
+	}
+	return false
+}
+
+// changesRemote reports whether the plan uploads or deletes anything.
+func (p syncPlan) changesRemote() bool {
+	return len(p.uploads)+len(p.deleteTypeConflicts)+len(p.deleteExtrasFiles)+len(p.deleteExtrasDirs) > 0
+}
+
+// cleanupOrphans deletes orphaned folders one at a time. Failures are logged
+// and recorded but do not fail the sync; ownership is kept so the next sync
+// retries.
+func (e *Engine) cleanupOrphans(ctx context.Context, client *sftp.Client, cfg config.Config, server config.ServerConfig, srv *state.ServerState, orphans []orphanFolder, journal *uploadJournal) {
+	listed := make(map[string]struct{}, len(srv.LastModIDs))
+	for _, id := range srv.LastModIDs {
+		listed[id] = struct{}{}
+	}
+	for _, orphan := range orphans {
+		if ctx.Err() != nil {
+			return
+		}
+		root := path.Join(server.SFTP.RemoteModsRoot, orphan.slug)
+		start := time.Now()
+		deleted, kept, err := removeOrphan(client, root, newSyncRules(server.SFTP.Rules, cfg.Sync.ModRules[orphan.modID]))
+		if err != nil {
+			recordSyncError(srv, "orphan_cleanup", "delete orphan folder", orphan.modID, err, e.now)
+			e.logger.Error("sftp orphan cleanup failed", "server_id", server.ID, "mod_id", orphan.modID, "stage", "orphan_cleanup", "remote_path", root, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+			continue
+		}
+		e.logger.Info("sftp orphan folder deleted", "server_id", server.ID, "mod_id", orphan.modID, "stage", "orphan_cleanup", "remote_path", root, "duration_ms", time.Since(start).Milliseconds(), "delete_count", deleted, "kept_count", kept)
+		delete(srv.OwnedRemoteFolders, orphan.slug)
+		for remotePath := range journal.underRoot(root) {
+			journal.remove(remotePath)
+		}
+		if _, ok := listed[orphan.modID]; !ok {
+			delete(srv.SyncedMods, orphan.modID)
+			delete(srv.LastDeepVerifyAt, orphan.modID)
+		}
+	}
+}
+
+// startCountdown applies shutdown.countdown_update_policy when a countdown is
+// already running and leaves a notice for the RCON controller to announce.
+func startCountdown(srv *state.ServerState, shutdown config.ShutdownConfig, now time.Time) {
+	deadline := now.Add(time.Duration(shutdown.GracePeriodSeconds) * time.Second)
+	var notice state.CountdownNotice
+	if srv.NeedsShutdown && srv.ShutdownDeadlineAt != nil {
+		switch shutdown.CountdownUpdatePolicy {
+		case config.CountdownPolicyExtend:
+			base := *srv.ShutdownDeadlineAt
+			if base.Before(now) {
+				base = now
+			}
+			deadline = base.Add(time.Duration(shutdown.ExtendBySeconds) * time.Second)
+			notice = state.CountdownNoticeExtended
+		case config.CountdownPolicyKeep:
+			deadline = *srv.ShutdownDeadlineAt
+			notice = state.CountdownNoticeMerged
+		default:
+			notice = state.CountdownNoticeRestarted
+		}
+	}
 	srv.NeedsModUpdate = false
 	srv.NeedsShutdown = true
 	srv.Stage = state.StageCountdown
-	deadline := now.Add(time.Duration(cfg.Shutdown.GracePeriodSeconds) * time.Second)
 	srv.ShutdownDeadlineAt = &deadline
 	srv.NextAnnounceAt = &now
-	srv.LastSuccessSyncAt = &now
-	return srv, nil
+	srv.CountdownNotice = notice
 }
 
 func recordSyncError(srv *state.ServerState, stage, step, modID string, err error, nowFn func() time.Time) {
@@ -211,16 +438,62 @@ func recordSyncError(srv *state.ServerState, stage, step, modID string, err erro
 	srv.LastErrorAt = &now
 }
 
-func syncMod(ctx context.Context, client *sftp.Client, localModPath, remoteModPath string) (syncPlan, error) {
+func syncMod(ctx context.Context, client *sftp.Client, localModPath, remoteModPath string, opts modSyncOptions) (syncPlan, error) {
 	localTree, err := buildLocalTree(localModPath)
 	if err != nil {
 		return syncPlan{}, fmt.Errorf("build local tree: %w", err)
 	}
-	remoteTree, err := buildRemoteTree(client, remoteModPath)
-	if err != nil {
-		return syncPlan{}, fmt.Errorf("build remote tree: %w", err)
+	if opts.checksum {
+		if err := hashLocalTree(localModPath, localTree, opts.hashCachePath); err != nil {
+			return syncPlan{}, fmt.Errorf("hash local tree: %w", err)
+		}
+	}
+	manifest, haveManifest := readRemoteManifest(client, remoteModPath)
+	var remoteTree map[string]treeEntry
+	walked := false
+	rootExists := true
+	// The manifest is removed before the first upload and every temp file is
+	// journaled before it is created, so a tree read from an intact manifest
+	// cannot hide a temp file unless the journal has one under this root.
+	journaled := len(opts.journal.underRoot(remoteModPath)) > 0
+	if opts.trustManifest && !journaled && haveManifest && !opts.expectVersion.IsZero() && manifest.ModVersion.Equal(opts.expectVersion) {
+		remoteTree = manifest.tree()
+	} else {
+		remoteTree, rootExists, err = buildRemoteTree(client, remoteModPath)
+		if err != nil {
+			return syncPlan{}, fmt.Errorf("build remote tree: %w", err)
+		}
+		walked = true
+	}
+	for _, tmp := range pruneTempFiles(remoteTree, opts.journal, remoteModPath) {
+		if err := client.Remove(path.Join(remoteModPath, tmp.Path)); err != nil {
+			return syncPlan{}, fmt.Errorf("delete stale temp file %s: %w", tmp.Path, err)
+		}
+	}
+	if walked && opts.checksum {
+		if err := applyRemoteHashes(remoteTree, manifest, opts.sshClient, remoteModPath); err != nil {
+			return syncPlan{}, fmt.Errorf("hash remote tree: %w", err)
+		}
+	}
+	plan := buildPlan(localTree, remoteTree, opts)
+	plan.remoteWalked = walked
+	if err := checkRemoteSpace(client, remoteModPath, rootExists, plan.uploads); errors.Is(err, errRemoteSpaceUnknown) {
+		plan.spaceUnknown = err
+	} else if err != nil {
+		return plan, fmt.Errorf("preflight disk: %w", err)
+	}
+	if !rootExists {
+		if err := client.MkdirAll(remoteModPath); err != nil {
+			return plan, fmt.Errorf("mkdir mod root: %w", err)
+		}
+		plan.createdRoot = true
+	}
+	if haveManifest && (opts.writeManifest || opts.checksum) {
+		// A sync that fails halfway must not leave a manifest describing the old tree.
+		if err := client.Remove(path.Join(remoteModPath, remoteManifestName)); err != nil {
+			return plan, fmt.Errorf("invalidate remote manifest: %w", err)
+		}
 	}
-	plan := buildPlan(localTree, remoteTree)
 
 	for _, entry := range plan.deleteTypeConflicts {
 		if err := deleteRemoteEntry(client, path.Join(remoteModPath, entry.Path), entry.IsDir); err != nil {
@@ -232,14 +505,17 @@ func syncMod(ctx context.Context, client *sftp.Client, localModPath, remoteModPa
 			return plan, fmt.Errorf("mkdir %s: %w", dir.Path, err)
 		}
 	}
-	for _, file := range plan.uploads {
-		select {
-		case <-ctx.Done():
-			return plan, ctx.Err()
-		default:
-		}
-		if err := uploadAtomically(client, filepath.Join(localModPath, filepath.FromSlash(file.Path)), path.Join(remoteModPath, file.Path), file.ModTime); err != nil {
-			return plan, fmt.Errorf("upload %s: %w", file.Path, err)
+	dropStaleJournalEntries(client, opts.journal, remoteModPath, plan.uploads)
+	uploadClients := opts.uploadClients
+	if len(uploadClients) == 0 {
+		uploadClients = []*sftp.Client{client}
+	}
+	if err := uploadFiles(ctx, uploadClients, localModPath, remoteModPath, plan.uploads, opts); err != nil {
+		return plan, err
+	}
+	for _, file := range plan.touches {
+		if err := client.Chtimes(path.Join(remoteModPath, file.Path), file.ModTime, file.ModTime); err != nil {
+			return plan, fmt.Errorf("set mtime %s: %w", file.Path, err)
 		}
 	}
 	for _, file := range plan.deleteExtrasFiles {
@@ -252,9 +528,80 @@ func syncMod(ctx context.Context, client *sftp.Client, localModPath, remoteModPa
 			return plan, fmt.Errorf("delete extra dir %s: %w", dir.Path, err)
 		}
 	}
+	if opts.checksum || opts.writeManifest {
+		if !opts.checksum && haveManifest {
+			reuseManifestHashes(localTree, manifest)
+		}
+		if err := writeRemoteManifest(client, remoteModPath, manifestFromTree(opts.rules.filterLocal(localTree), opts.manifestVersion, time.Now())); err != nil {
+			return plan, fmt.Errorf("write remote manifest: %w", err)
+		}
+	}
 	return plan, nil
 }
 
+// uploadFiles runs the upload phase with a bounded worker pool spread across
+// the given SFTP sessions. Directories already exist at this point and
+// deletions only start after every upload has finished, so uploads can run in
+// any order. The first failure cancels the remaining uploads.
+func uploadFiles(ctx context.Context, clients []*sftp.Client, localModPath, remoteModPath string, uploads []treeEntry, opts modSyncOptions) error {
+	workers := opts.fileWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(uploads) {
+		workers = len(uploads)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan treeEntry)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < workers; i++ {
+		client := clients[i%len(clients)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if err := uploadAtomically(ctx, client, filepath.Join(localModPath, filepath.FromSlash(file.Path)), path.Join(remoteModPath, file.Path), file.ModTime, opts.journal, opts.resume, opts.bandwidth); err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("upload %s: %w", file.Path, err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, file := range uploads {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- file:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// ClientOptions maps sync tuning settings to SFTP client options.
+func ClientOptions(cfg config.SyncConfig) []sftp.ClientOption {
+	opts := make([]sftp.ClientOption, 0, 2)
+	if cfg.MaxConcurrentRequestsPerFile > 0 {
+		opts = append(opts, sftp.MaxConcurrentRequestsPerFile(cfg.MaxConcurrentRequestsPerFile))
+	}
+	if cfg.UseConcurrentWrites {
+		opts = append(opts, sftp.UseConcurrentWrites(true))
+	}
+	return opts
+}
+
 func deleteRemoteEntry(client *sftp.Client, fullPath string, isDir bool) error {
 	if isDir {
 		return client.RemoveDirectory(fullPath)
@@ -262,31 +609,65 @@ func deleteRemoteEntry(client *sftp.Client, fullPath string, isDir bool) error {
 	return client.Remove(fullPath)
 }
 
-func uploadAtomically(client *sftp.Client, localPath, remotePath string, mtime time.Time) error {
+// uploadAtomically writes to a deterministic temp path derived from the remote
+// path, size and mtime, then renames it into place. A failed copy leaves the
+// temp file and its journal entry behind so the next attempt can resume. With
+// resume off (concurrent writes may leave holes before the temp file's end)
+// the temp file is always rewritten from zero.
+func uploadAtomically(ctx context.Context, client *sftp.Client, localPath, remotePath string, mtime time.Time, journal *uploadJournal, resume bool, bandwidth []*rateLimiter) error {
 	src, err := os.Open(localPath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
-
-	tmpPath := remotePath + fmt.Sprintf(".tmp-%d", time.Now().UnixNano())
-	dst, err := client.Create(tmpPath)
+	info, err := src.Stat()
 	if err != nil {
 		return err
 	}
-	if _, err := io.Copy(dst, src); err != nil {
+
+	size := info.Size()
+	tmpPath := tempUploadPath(remotePath, size, mtime)
+	var offset int64
+	if p, ok := journal.get(remotePath); ok && resume && p.TmpPath == tmpPath && p.Size == size && p.MTime == mtime.UTC().Unix() {
+		offset = resumeOffset(client, src, tmpPath, size)
+	} else {
+		if err := journal.put(remotePath, state.PartialUpload{TmpPath: tmpPath, Size: size, MTime: mtime.UTC().Unix(), StartedAt: time.Now().UTC()}); err != nil {
+			return err
+		}
+	}
+
+	var dst io.WriteCloser
+	if offset > 0 {
+		f, err := client.OpenFile(tmpPath, os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := src.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		dst = f
+	} else {
+		dst, err = client.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(dst, throttle(ctx, src, bandwidth)); err != nil {
 		dst.Close()
-		_ = client.Remove(tmpPath)
 		return err
 	}
 	if err := dst.Close(); err != nil {
-		_ = client.Remove(tmpPath)
 		return err
 	}
 	if err := client.Rename(tmpPath, remotePath); err != nil {
-		_ = client.Remove(tmpPath)
 		return err
 	}
+	journal.remove(remotePath)
 	sec := mtime.UTC().Truncate(time.Second)
 	if err := client.Chtimes(remotePath, sec, sec); err != nil {
 		return err
@@ -317,18 +698,19 @@ func buildLocalTree(root string) (map[string]treeEntry, error) {
 	return tree, nil
 }
 
-func buildRemoteTree(client *sftp.Client, root string) (map[string]treeEntry, error) {
+// buildRemoteTree walks root and reports whether it exists at all.
+func buildRemoteTree(client *sftp.Client, root string) (map[string]treeEntry, bool, error) {
 	tree := map[string]treeEntry{}
 	if _, err := client.Stat(root); err != nil {
-		if os.IsNotExist(err) || strings.Contains(strings.ToLower(err.Error()), "not exist") {
-			return tree, nil
+		if isNotExist(err) {
+			return tree, false, nil
 		}
-		return nil, err
+		return nil, false, err
 	}
 	walker := client.Walk(root)
 	for walker.Step() {
 		if err := walker.Err(); err != nil {
-			return nil, err
+			return nil, true, err
 		}
 		info := walker.Stat()
 		if info == nil {
@@ -336,19 +718,29 @@ func buildRemoteTree(client *sftp.Client, root string) (map[string]treeEntry, er
 		}
 		rel := strings.TrimPrefix(walker.Path(), root)
 		rel = strings.TrimPrefix(rel, "/")
-		if rel == "" || rel == "." {
+		if rel == "" || rel == "." || rel == remoteManifestName {
 			continue
 		}
 		mt := info.ModTime().UTC().Truncate(time.Second)
 		tree[rel] = treeEntry{Path: rel, IsDir: info.IsDir(), Size: info.Size(), MTime: mt.Unix(), ModTime: mt}
 	}
-	return tree, nil
+	return tree, true, nil
+}
+
+func isNotExist(err error) bool {
+	return os.IsNotExist(err) || strings.Contains(strings.ToLower(err.Error()), "not exist")
 }
 
-func buildPlan(localTree, remoteTree map[string]treeEntry) syncPlan {
+func buildPlan(localTree, remoteTree map[string]treeEntry, opts modSyncOptions) syncPlan {
 	plan := syncPlan{}
+	rules := opts.rules
+	localTree = rules.filterLocal(localTree)
+	keptRemote := rules.keptRemote(remoteTree)
 	for rel, local := range localTree {
 		remote, exists := remoteTree[rel]
+		if exists && rules.protected(rel) {
+			continue
+		}
 		if !exists {
 			if local.IsDir {
 				plan.mkdirs = append(plan.mkdirs, local)
@@ -366,7 +758,19 @@ func buildPlan(localTree, remoteTree map[string]treeEntry) syncPlan {
 			}
 			continue
 		}
-		if !local.IsDir && (local.Size != remote.Size || local.MTime != remote.MTime) {
+		if local.IsDir {
+			continue
+		}
+		if opts.checksum {
+			switch {
+			case local.Size != remote.Size || local.Hash == "" || remote.Hash == "" || local.Hash != remote.Hash:
+				plan.uploads = append(plan.uploads, local)
+			case local.MTime != remote.MTime:
+				plan.touches = append(plan.touches, local)
+			}
+			continue
+		}
+		if local.Size != remote.Size || local.MTime != remote.MTime {
 			plan.uploads = append(plan.uploads, local)
 		}
 	}
@@ -374,6 +778,9 @@ func buildPlan(localTree, remoteTree map[string]treeEntry) syncPlan {
 		if _, exists := localTree[rel]; exists {
 			continue
 		}
+		if _, kept := keptRemote[rel]; kept {
+			continue
+		}
 		if remote.IsDir {
 			plan.deleteExtrasDirs = append(plan.deleteExtrasDirs, remote)
 		} else {
@@ -393,6 +800,7 @@ func buildPlan(localTree, remoteTree map[string]treeEntry) syncPlan {
 		return di < dj
 	})
 	sort.Slice(plan.uploads, func(i, j int) bool { return plan.uploads[i].Path < plan.uploads[j].Path })
+	sort.Slice(plan.touches, func(i, j int) bool { return plan.touches[i].Path < plan.touches[j].Path })
 	sort.Slice(plan.deleteExtrasFiles, func(i, j int) bool { return plan.deleteExtrasFiles[i].Path < plan.deleteExtrasFiles[j].Path })
 	sort.Slice(plan.deleteExtrasDirs, func(i, j int) bool {
 		di := pathDepth(plan.deleteExtrasDirs[i].Path)
@@ -412,54 +820,27 @@ func pathDepth(p string) int {
 	return strings.Count(p, "/") + 1
 }
 
-func dialSFTP(ctx context.Context, server config.ServerConfig) (*sftp.Client, *ssh.Client, error) {
-	sshConfig := &ssh.ClientConfig{User: server.SFTP.User, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
-	switch server.SFTP.Auth.Type {
-	case "password":
-		sshConfig.Auth = []ssh.AuthMethod{ssh.Password(server.SFTP.Auth.Password)}
-	default:
-		return nil, nil, fmt.Errorf("unsupported sftp auth type %q", server.SFTP.Auth.Type)
-	}
-	addr := fmt.Sprintf("%s:%d", server.SFTP.Host, server.SFTP.Port)
+// acquire borrows a connection for server, retrying failed dials with the
+// server's backoff.
+func (e *Engine) acquire(ctx context.Context, server config.ServerConfig) (*sshpool.Lease, error) {
 	var lastErr error
 	for attempt := 1; attempt <= server.SFTP.MaxRetries; attempt++ {
-		connCh := make(chan struct {
-			conn *ssh.Client
-			err  error
-		}, 1)
-		go func() {
-			conn, err := ssh.Dial("tcp", addr, sshConfig)
-			connCh <- struct {
-				conn *ssh.Client
-				err  error
-			}{conn: conn, err: err}
-		}()
-		select {
-		case <-time.After(time.Duration(server.SFTP.ConnectTimeoutSeconds) * time.Second):
-			lastErr = fmt.Errorf("sftp connect timed out")
-		case <-ctx.Done():
-			return nil, nil, ctx.Err()
-		case res := <-connCh:
-			if res.err != nil {
-				lastErr = res.err
-			} else {
-				client, err := sftp.NewClient(res.conn)
-				if err != nil {
-					res.conn.Close()
-					lastErr = err
-				} else {
-					return client, res.conn, nil
-				}
-			}
+		lease, err := e.pool.Acquire(ctx, server)
+		if err == nil {
+			return lease, nil
 		}
-		if attempt == server.SFTP.MaxRetries {
+		lastErr = err
+		if ctx.Err() != nil || attempt == server.SFTP.MaxRetries {
 			break
 		}
 		select {
 		case <-ctx.Done():
-			return nil, nil, ctx.Err()
+			return nil, ctx.Err()
 		case <-time.After(time.Duration(server.SFTP.RetryBackoffMillis*attempt) * time.Millisecond):
 		}
 	}
-	return nil, nil, lastErr
+	if lastErr == nil {
+		lastErr = fmt.Errorf("sftp connect: no attempts made (max_retries=%d)", server.SFTP.MaxRetries)
+	}
+	return nil, lastErr
 }
@@ -1,8 +1,22 @@
 package sftpsync
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+	"github.com/pkg/sftp"
 )
 
 func TestBuildPlanDetectsChangesAndConflicts(t *testing.T) {
@@ -16,7 +30,7 @@ func TestBuildPlanDetectsChangesAndConflicts(t *testing.T) {
 		"dir/file.txt": {Path: "dir/file.txt", IsDir: false, Size: 9, MTime: 100},
 		"extra.txt":    {Path: "extra.txt", IsDir: false},
 	}
-	plan := buildPlan(local, remote)
+	plan := buildPlan(local, remote, modSyncOptions{})
 	if len(plan.deleteTypeConflicts) != 1 || plan.deleteTypeConflicts[0].Path != "dir" {
 		t.Fatalf("unexpected type conflicts: %#v", plan.deleteTypeConflicts)
 	}
@@ -38,7 +52,7 @@ func TestDeletionOrderingDirectoriesByDescendingDepth(t *testing.T) {
 		"a/b":   {Path: "a/b", IsDir: true},
 		"a/b/c": {Path: "a/b/c", IsDir: true},
 	}
-	plan := buildPlan(local, remote)
+	plan := buildPlan(local, remote, modSyncOptions{})
 	got := []string{plan.deleteExtrasDirs[0].Path, plan.deleteExtrasDirs[1].Path, plan.deleteExtrasDirs[2].Path}
 	want := []string{"a/b/c", "a/b", "a"}
 	for i := range want {
@@ -56,8 +70,617 @@ func TestFileEqualityUsesMtimeSeconds(t *testing.T) {
 	remote := map[string]treeEntry{
 		"file.bin": {Path: "file.bin", IsDir: false, Size: 5, MTime: base.Add(900 * time.Millisecond).Truncate(time.Second).Unix()},
 	}
-	plan := buildPlan(local, remote)
+	plan := buildPlan(local, remote, modSyncOptions{})
 	if len(plan.uploads) != 0 {
 		t.Fatalf("expected no uploads when size+mtime seconds match, got %#v", plan.uploads)
 	}
 }
+
+func TestStartCountdownPolicies(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	running := now.Add(2 * time.Minute)
+	shutdown := config.ShutdownConfig{GracePeriodSeconds: 300, ExtendBySeconds: 120}
+	cases := []struct {
+		policy string
+		want   time.Time
+		notice state.CountdownNotice
+	}{
+		{policy: config.CountdownPolicyRestart, want: now.Add(5 * time.Minute), notice: state.CountdownNoticeRestarted},
+		{policy: config.CountdownPolicyExtend, want: running.Add(2 * time.Minute), notice: state.CountdownNoticeExtended},
+		{policy: config.CountdownPolicyKeep, want: running, notice: state.CountdownNoticeMerged},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			deadline := running
+			srv := state.ServerState{NeedsShutdown: true, NeedsModUpdate: true, Stage: state.StageSyncing, ShutdownDeadlineAt: &deadline}
+			shutdown.CountdownUpdatePolicy = tc.policy
+			startCountdown(&srv, shutdown, now)
+			if !srv.ShutdownDeadlineAt.Equal(tc.want) {
+				t.Fatalf("deadline got=%s want=%s", srv.ShutdownDeadlineAt, tc.want)
+			}
+			if srv.CountdownNotice != tc.notice {
+				t.Fatalf("notice got=%q want=%q", srv.CountdownNotice, tc.notice)
+			}
+			if srv.Stage != state.StageCountdown || srv.NeedsModUpdate || !srv.NeedsShutdown {
+				t.Fatalf("unexpected server state: %#v", srv)
+			}
+		})
+	}
+
+	fresh := state.ServerState{NeedsModUpdate: true}
+	startCountdown(&fresh, shutdown, now)
+	if fresh.CountdownNotice != "" || !fresh.ShutdownDeadlineAt.Equal(now.Add(5*time.Minute)) {
+		t.Fatalf("unexpected fresh countdown: %#v", fresh)
+	}
+}
+
+func TestBuildPlanHonorsExcludeAndProtectRules(t *testing.T) {
+	local := map[string]treeEntry{
+		"addons":            {Path: "addons", IsDir: true},
+		"addons/a.pbo":      {Path: "addons/a.pbo", Size: 10, MTime: 100},
+		"addons/src.cpp":    {Path: "addons/src.cpp", Size: 5, MTime: 100},
+		"meta.cpp":          {Path: "meta.cpp", Size: 4, MTime: 100},
+		"keys":              {Path: "keys", IsDir: true},
+		"keys/author.bikey": {Path: "keys/author.bikey", Size: 2, MTime: 100},
+		"profiles":          {Path: "profiles", IsDir: true},
+		"profiles/cfg.json": {Path: "profiles/cfg.json", Size: 1, MTime: 100},
+	}
+	remote := map[string]treeEntry{
+		"addons":             {Path: "addons", IsDir: true},
+		"meta.cpp":           {Path: "meta.cpp", Size: 9, MTime: 1},
+		"keys":               {Path: "keys", IsDir: true},
+		"keys/author.bikey":  {Path: "keys/author.bikey", Size: 3, MTime: 1},
+		"keys/server.bikey":  {Path: "keys/server.bikey", Size: 3, MTime: 1},
+		"profiles":           {Path: "profiles", IsDir: true},
+		"profiles/cfg.json":  {Path: "profiles/cfg.json", Size: 7, MTime: 1},
+		"profiles/live.json": {Path: "profiles/live.json", Size: 7, MTime: 1},
+		"stale.txt":          {Path: "stale.txt", Size: 1, MTime: 1},
+	}
+	rules := newSyncRules(
+		config.SyncRulesConfig{Exclude: []string{"*.cpp"}, Protect: []string{"keys/server.bikey"}},
+		config.SyncRulesConfig{Protect: []string{"profiles"}},
+	)
+	plan := buildPlan(local, remote, modSyncOptions{rules: rules})
+
+	var uploads []string
+	for _, u := range plan.uploads {
+		uploads = append(uploads, u.Path)
+	}
+	if len(uploads) != 2 || uploads[0] != "addons/a.pbo" || uploads[1] != "keys/author.bikey" {
+		t.Fatalf("unexpected uploads: %v", uploads)
+	}
+	if len(plan.deleteExtrasFiles) != 1 || plan.deleteExtrasFiles[0].Path != "stale.txt" {
+		t.Fatalf("unexpected deletes: %#v", plan.deleteExtrasFiles)
+	}
+	if len(plan.deleteExtrasDirs) != 0 || len(plan.deleteTypeConflicts) != 0 {
+		t.Fatalf("unexpected dir deletes: %#v %#v", plan.deleteExtrasDirs, plan.deleteTypeConflicts)
+	}
+}
+
+func TestBuildPlanIncludeRulesLimitScope(t *testing.T) {
+	local := map[string]treeEntry{
+		"addons":       {Path: "addons", IsDir: true},
+		"addons/a.pbo": {Path: "addons/a.pbo", Size: 1, MTime: 1},
+		"docs":         {Path: "docs", IsDir: true},
+		"docs/readme":  {Path: "docs/readme", Size: 1, MTime: 1},
+	}
+	remote := map[string]treeEntry{
+		"server.cfg": {Path: "server.cfg", Size: 1, MTime: 1},
+	}
+	plan := buildPlan(local, remote, modSyncOptions{rules: newSyncRules(config.SyncRulesConfig{Include: []string{"addons/*"}})})
+	if len(plan.mkdirs) != 1 || plan.mkdirs[0].Path != "addons" {
+		t.Fatalf("unexpected mkdirs: %#v", plan.mkdirs)
+	}
+	if len(plan.uploads) != 1 || plan.uploads[0].Path != "addons/a.pbo" {
+		t.Fatalf("unexpected uploads: %#v", plan.uploads)
+	}
+	if len(plan.deleteExtrasFiles) != 0 {
+		t.Fatalf("files outside include scope must not be deleted: %#v", plan.deleteExtrasFiles)
+	}
+}
+
+func TestBuildPlanChecksumModeComparesHashes(t *testing.T) {
+	local := map[string]treeEntry{
+		"same.pbo":    {Path: "same.pbo", Size: 5, MTime: 200, Hash: "aa"},
+		"changed.pbo": {Path: "changed.pbo", Size: 5, MTime: 100, Hash: "bb"},
+		"unknown.pbo": {Path: "unknown.pbo", Size: 5, MTime: 100, Hash: "cc"},
+	}
+	remote := map[string]treeEntry{
+		"same.pbo":    {Path: "same.pbo", Size: 5, MTime: 100, Hash: "aa"},
+		"changed.pbo": {Path: "changed.pbo", Size: 5, MTime: 100, Hash: "00"},
+		"unknown.pbo": {Path: "unknown.pbo", Size: 5, MTime: 100},
+	}
+	plan := buildPlan(local, remote, modSyncOptions{checksum: true})
+	if len(plan.uploads) != 2 || plan.uploads[0].Path != "changed.pbo" || plan.uploads[1].Path != "unknown.pbo" {
+		t.Fatalf("unexpected uploads: %#v", plan.uploads)
+	}
+	if len(plan.touches) != 1 || plan.touches[0].Path != "same.pbo" {
+		t.Fatalf("expected mtime-only fix for identical content, got %#v", plan.touches)
+	}
+}
+
+func TestHashLocalTreeReusesCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.pbo"), []byte("payload"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := buildLocalTree(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(t.TempDir(), "hashes", "mod.json")
+	if err := hashLocalTree(root, tree, cachePath); err != nil {
+		t.Fatal(err)
+	}
+	want := "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+	if tree["a.pbo"].Hash != want {
+		t.Fatalf("unexpected hash %q", tree["a.pbo"].Hash)
+	}
+
+	cached := localHashCache{Version: localHashCacheFormat, Files: map[string]manifestEntry{
+		"a.pbo": {Size: tree["a.pbo"].Size, MTime: tree["a.pbo"].MTime, SHA256: "cached"},
+	}}
+	if err := writeJSONAtomic(cachePath, cached); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ = buildLocalTree(root)
+	if err := hashLocalTree(root, tree, cachePath); err != nil {
+		t.Fatal(err)
+	}
+	if tree["a.pbo"].Hash != "cached" {
+		t.Fatalf("expected cached digest to be reused, got %q", tree["a.pbo"].Hash)
+	}
+}
+
+func TestApplyRemoteHashesIgnoresStaleManifestEntries(t *testing.T) {
+	remote := map[string]treeEntry{
+		"fresh.pbo": {Path: "fresh.pbo", Size: 5, MTime: 100},
+		"stale.pbo": {Path: "stale.pbo", Size: 5, MTime: 300},
+	}
+	manifest := remoteManifest{Files: map[string]manifestEntry{
+		"fresh.pbo": {Size: 5, MTime: 100, SHA256: "aa"},
+		"stale.pbo": {Size: 5, MTime: 100, SHA256: "bb"},
+	}}
+	if err := applyRemoteHashes(remote, manifest, nil, "/mods/x"); err != nil {
+		t.Fatal(err)
+	}
+	if remote["fresh.pbo"].Hash != "aa" || remote["stale.pbo"].Hash != "" {
+		t.Fatalf("unexpected remote hashes: %#v", remote)
+	}
+}
+
+func TestParseSHA256SumOutput(t *testing.T) {
+	sum := "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5"
+	got := parseSHA256SumOutput(sum + "  addons/a b.pbo\n" + sum + " *keys/k.bikey\nsha256sum: missing: No such file\n")
+	if len(got) != 2 || got["addons/a b.pbo"] != sum || got["keys/k.bikey"] != sum {
+		t.Fatalf("unexpected parsed sums: %#v", got)
+	}
+}
+
+func TestManifestTreeRoundTrip(t *testing.T) {
+	version := time.Unix(1700000000, 0).UTC()
+	local := map[string]treeEntry{
+		"addons":       {Path: "addons", IsDir: true},
+		"addons/a.pbo": {Path: "addons/a.pbo", Size: 5, MTime: 100, ModTime: time.Unix(100, 0).UTC(), Hash: "aa"},
+	}
+	manifest := manifestFromTree(local, version, version)
+	if !manifest.ModVersion.Equal(version) || len(manifest.Dirs) != 1 || len(manifest.Files) != 1 {
+		t.Fatalf("unexpected manifest: %#v", manifest)
+	}
+	plan := buildPlan(local, manifest.tree(), modSyncOptions{checksum: true})
+	if len(plan.mkdirs)+len(plan.uploads)+len(plan.touches)+len(plan.deleteExtrasFiles)+len(plan.deleteExtrasDirs) != 0 {
+		t.Fatalf("expected empty plan against own manifest, got %#v", plan)
+	}
+}
+
+func TestSyncServerDeepVerifiesUnchangedModsWhenDue(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	localRoot := t.TempDir()
+	for _, slug := range []string{"changed", "unchanged"} {
+		if err := os.MkdirAll(filepath.Join(localRoot, slug), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Config{
+		Paths:       config.PathsConfig{LocalModsRoot: localRoot, LocalCacheRoot: t.TempDir()},
+		Shutdown:    config.ShutdownConfig{GracePeriodSeconds: 60},
+		Concurrency: config.ConcurrencyConfig{SFTPSyncParallelismModsPerServer: 2},
+		Sync:        config.SyncConfig{RemoteListing: config.RemoteListingManifest, DeepVerifyHours: 24},
+	}
+	server := config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{Auth: config.SFTPAuthConfig{Type: "password"}, RemoteModsRoot: "/mods", MaxRetries: 1, ConnectTimeoutSeconds: 1, OperationTimeoutSeconds: 5}}
+	mods := map[string]state.ModState{
+		"1": {FolderSlug: "changed", LocalUpdatedAt: now},
+		"2": {FolderSlug: "unchanged", LocalUpdatedAt: now.Add(-time.Hour)},
+	}
+	srv := state.ServerState{
+		LastModIDs:       []string{"1", "2"},
+		NeedsModUpdate:   true,
+		SyncedMods:       map[string]time.Time{"1": now.Add(-2 * time.Hour), "2": now.Add(-time.Hour)},
+		LastDeepVerifyAt: map[string]time.Time{"2": now.Add(-48 * time.Hour)},
+	}
+	engine := NewEngine()
+	engine.now = func() time.Time { return now }
+
+	updated, err := engine.syncServer(context.Background(), cfg, server, mods, srv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.LastDeepVerifyAt["2"].Equal(now) {
+		t.Fatalf("expected unchanged mod to be deep verified, got %#v", updated.LastDeepVerifyAt)
+	}
+	if !updated.SyncedMods["1"].Equal(now) || updated.Stage != state.StageCountdown {
+		t.Fatalf("unexpected server state after sync: %#v", updated)
+	}
+	if !slices.Equal(updated.UpdatedMods, []string{"1"}) {
+		t.Fatalf("expected only the new version to count as updated, got %#v", updated.UpdatedMods)
+	}
+}
+
+func TestTempUploadPathIsDeterministic(t *testing.T) {
+	mtime := time.Unix(1700000000, 0).UTC()
+	a := tempUploadPath("/mods/cf/addons/a.pbo", 10, mtime)
+	b := tempUploadPath("/mods/cf/addons/a.pbo", 10, mtime.Add(500*time.Millisecond))
+	c := tempUploadPath("/mods/cf/addons/a.pbo", 11, mtime)
+	if a != b {
+		t.Fatalf("expected same temp path for same size and mtime second, got %q and %q", a, b)
+	}
+	if a == c {
+		t.Fatalf("expected different temp path when size changes")
+	}
+	if !tmpSuffixPattern.MatchString(a) {
+		t.Fatalf("temp path %q does not match cleanup pattern", a)
+	}
+}
+
+func TestPruneTempFilesKeepsJournaledUploads(t *testing.T) {
+	live := tempUploadPath("/mods/cf/big.pbo", 100, time.Unix(1, 0))
+	liveRel := path.Base(live)
+	journal := newUploadJournal(map[string]state.PartialUpload{
+		"/mods/cf/big.pbo": {TmpPath: live, Size: 100, MTime: 1},
+	})
+	remote := map[string]treeEntry{
+		"big.pbo":                   {Path: "big.pbo", Size: 50},
+		liveRel:                     {Path: liveRel, Size: 60},
+		"old.pbo.tmp-1700000000123": {Path: "old.pbo.tmp-1700000000123", Size: 5},
+	}
+	stale := pruneTempFiles(remote, journal, "/mods/cf")
+	if len(stale) != 1 || stale[0].Path != "old.pbo.tmp-1700000000123" {
+		t.Fatalf("unexpected stale temp files: %#v", stale)
+	}
+	if len(remote) != 1 {
+		t.Fatalf("expected temp files to be removed from the remote tree, got %#v", remote)
+	}
+}
+
+func TestDropStaleJournalEntries(t *testing.T) {
+	journal := newUploadJournal(map[string]state.PartialUpload{
+		"/mods/cf/keep.pbo":    {TmpPath: "/mods/cf/keep.pbo.tmp-aa", Size: 10, MTime: 5},
+		"/mods/cf/changed.pbo": {TmpPath: "/mods/cf/changed.pbo.tmp-bb", Size: 10, MTime: 5},
+		"/mods/other/x.pbo":    {TmpPath: "/mods/other/x.pbo.tmp-cc", Size: 1, MTime: 1},
+	})
+	uploads := []treeEntry{
+		{Path: "keep.pbo", Size: 10, MTime: 5},
+		{Path: "changed.pbo", Size: 12, MTime: 6},
+	}
+	dropStaleJournalEntries(&sftp.Client{}, journal, "/mods/cf", uploads)
+	got := journal.snapshot()
+	if len(got) != 2 {
+		t.Fatalf("unexpected journal after prune: %#v", got)
+	}
+	if _, ok := got["/mods/cf/changed.pbo"]; ok {
+		t.Fatalf("expected changed upload to be dropped from journal")
+	}
+}
+
+func TestUploadJournalPersistsEachChange(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "servers", "s1", "partial_uploads.json")
+	journal, err := loadUploadJournal(journalPath, map[string]state.PartialUpload{
+		"/mods/cf/old.pbo": {TmpPath: "/mods/cf/old.pbo.tmp-aa", Size: 1, MTime: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.put("/mods/cf/a.pbo", state.PartialUpload{TmpPath: "/mods/cf/a.pbo.tmp-bb", Size: 10, MTime: 5}); err != nil {
+		t.Fatal(err)
+	}
+	journal.remove("/mods/cf/old.pbo")
+
+	reloaded, err := loadUploadJournal(journalPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reloaded.snapshot()
+	if len(got) != 1 || got["/mods/cf/a.pbo"].TmpPath != "/mods/cf/a.pbo.tmp-bb" {
+		t.Fatalf("unexpected reloaded journal: %#v", got)
+	}
+}
+
+func TestPrefixMatchesComparesWholePrefix(t *testing.T) {
+	local := strings.NewReader(strings.Repeat("a", 4<<20) + "tail")
+	if !prefixMatches(strings.NewReader(strings.Repeat("a", 4<<20)), local, 4<<20) {
+		t.Fatalf("expected matching prefix")
+	}
+	corrupt := []byte(strings.Repeat("a", 4<<20))
+	corrupt[10] = 'b'
+	if prefixMatches(strings.NewReader(string(corrupt)), local, 4<<20) {
+		t.Fatalf("expected corruption outside the last MiB to be detected")
+	}
+	if prefixMatches(strings.NewReader("aaa"), local, 4) {
+		t.Fatalf("expected short remote file to fail")
+	}
+}
+
+func TestUploadFilesWorkerPool(t *testing.T) {
+	local := t.TempDir()
+	uploads := make([]treeEntry, 0, 5)
+	for _, name := range []string{"a.pbo", "b.pbo", "c.pbo", "d.pbo", "e.pbo"} {
+		if err := os.WriteFile(filepath.Join(local, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		uploads = append(uploads, treeEntry{Path: name, Size: int64(len(name)), ModTime: time.Unix(1700000000, 0)})
+	}
+	clients := []*sftp.Client{{}, {}}
+	if err := uploadFiles(context.Background(), clients, local, "/mods/cf", uploads, modSyncOptions{fileWorkers: 3}); err != nil {
+		t.Fatalf("unexpected upload error: %v", err)
+	}
+
+	missing := append(uploads, treeEntry{Path: "missing.pbo", ModTime: time.Unix(1700000000, 0)})
+	err := uploadFiles(context.Background(), clients, local, "/mods/cf", missing, modSyncOptions{fileWorkers: 4})
+	if err == nil || !strings.Contains(err.Error(), "missing.pbo") {
+		t.Fatalf("expected upload error for missing.pbo, got %v", err)
+	}
+}
+
+func TestLimitAtQuietHours(t *testing.T) {
+	cfg := config.BandwidthConfig{
+		MaxBytesPerSecond: 1000,
+		QuietHours: []config.QuietHoursConfig{
+			{Start: "23:00", End: "06:00", MaxBytesPerSecond: 0},
+			{Start: "12:00", End: "13:30", MaxBytesPerSecond: 50},
+		},
+	}
+	cases := []struct {
+		hour, minute int
+		want         int64
+	}{
+		{23, 30, 0},
+		{2, 0, 0},
+		{6, 0, 1000},
+		{12, 15, 50},
+		{13, 30, 1000},
+	}
+	for _, tc := range cases {
+		at := time.Date(2024, 1, 1, tc.hour, tc.minute, 0, 0, time.Local)
+		if got := limitAt(cfg, at); got != tc.want {
+			t.Fatalf("limitAt %02d:%02d = %d, want %d", tc.hour, tc.minute, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimiterDebtAndRefill(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	l := newRateLimiter(config.BandwidthConfig{MaxBytesPerSecond: 100})
+	l.now = func() time.Time { return now }
+	if err := l.wait(context.Background(), 100); err != nil {
+		t.Fatalf("initial burst should not block: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 50); err == nil {
+		t.Fatalf("expected wait to block once the burst is spent")
+	}
+	now = now.Add(time.Second)
+	if err := l.wait(ctx, 50); err != nil {
+		t.Fatalf("expected refilled bucket to cover the read, got %v", err)
+	}
+	if newRateLimiter(config.BandwidthConfig{}) != nil {
+		t.Fatalf("expected no limiter without limits")
+	}
+}
+
+func TestFindOrphansSkipsFoldersStillInUse(t *testing.T) {
+	owned := map[string]string{"cf": "1", "old-trader": "2", "renamed-old": "3"}
+	mods := map[string]state.ModState{
+		"1": {FolderSlug: "cf"},
+		"2": {FolderSlug: "old-trader"},
+		"3": {FolderSlug: "renamed-new"},
+	}
+	orphans := findOrphans(owned, []string{"1", "3"}, mods)
+	if len(orphans) != 2 || orphans[0].slug != "old-trader" || orphans[1].slug != "renamed-old" {
+		t.Fatalf("unexpected orphans: %#v", orphans)
+	}
+}
+
+func TestSyncServerDeletesOwnedOrphansOnlyWhenEnabled(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	cfg := config.Config{
+		Paths:       config.PathsConfig{LocalModsRoot: t.TempDir(), LocalCacheRoot: t.TempDir()},
+		Shutdown:    config.ShutdownConfig{GracePeriodSeconds: 60},
+		Concurrency: config.ConcurrencyConfig{SFTPSyncParallelismModsPerServer: 1},
+	}
+	server := config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{Auth: config.SFTPAuthConfig{Type: "password"}, RemoteModsRoot: "/mods", MaxRetries: 1, ConnectTimeoutSeconds: 1, OperationTimeoutSeconds: 5}}
+	mods := map[string]state.ModState{
+		"1": {FolderSlug: "cf", LocalUpdatedAt: now},
+		"9": {FolderSlug: "removed", LocalUpdatedAt: now},
+	}
+	newState := func() state.ServerState {
+		return state.ServerState{
+			LastModIDs:         []string{"1"},
+			NeedsModUpdate:     true,
+			SyncedMods:         map[string]time.Time{"1": now, "9": now},
+			OwnedRemoteFolders: map[string]string{"cf": "1", "removed": "9"},
+		}
+	}
+	engine := NewEngine()
+	engine.now = func() time.Time { return now }
+
+	dryRun, err := engine.syncServer(context.Background(), cfg, server, mods, newState(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dryRun.OwnedRemoteFolders["removed"]; !ok || dryRun.SyncedMods["9"].IsZero() {
+		t.Fatalf("dry run must not touch orphan state: %#v", dryRun)
+	}
+
+	cfg.Sync.DeleteOrphans = true
+	cleaned, err := engine.syncServer(context.Background(), cfg, server, mods, newState(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cleaned.OwnedRemoteFolders["removed"]; ok {
+		t.Fatalf("expected orphan ownership to be dropped: %#v", cleaned.OwnedRemoteFolders)
+	}
+	if _, ok := cleaned.OwnedRemoteFolders["cf"]; !ok {
+		t.Fatalf("expected listed mod folder to stay owned")
+	}
+	if _, ok := cleaned.SyncedMods["9"]; ok || cleaned.Stage != state.StageCountdown {
+		t.Fatalf("unexpected server state after cleanup: %#v", cleaned)
+	}
+}
+
+func TestRemoteSpaceError(t *testing.T) {
+	vfs := &sftp.StatVFS{Frsize: 4096, Bavail: 10}
+	if err := remoteSpaceError(vfs, "/mods/@cf", 40960); err != nil {
+		t.Fatalf("expected exact fit to pass, got %v", err)
+	}
+	err := remoteSpaceError(vfs, "/mods/@cf", 40961)
+	if !diskspace.IsInsufficient(err) {
+		t.Fatalf("expected insufficient space error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "/mods/@cf") || !strings.Contains(err.Error(), "40960 available") {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+	if err := remoteSpaceError(&sftp.StatVFS{Bsize: 512, Bavail: 2}, "/mods/@cf", 1024); err != nil {
+		t.Fatalf("expected bsize fallback when frsize is zero, got %v", err)
+	}
+}
+
+func TestCheckRemoteSpaceReportsUnknownSpace(t *testing.T) {
+	if err := checkRemoteSpace(&sftp.Client{}, "/mods/@cf", true, nil); err != nil {
+		t.Fatalf("expected no check without uploads, got %v", err)
+	}
+	err := checkRemoteSpace(&sftp.Client{}, "/mods/@cf", true, []treeEntry{{Path: "addons/cf.pbo", Size: 10}})
+	if !errors.Is(err, errRemoteSpaceUnknown) {
+		t.Fatalf("expected unknown remote space, got %v", err)
+	}
+}
+
+func TestSyncServerLogsSkippedRemotePreflightOnce(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	localRoot := t.TempDir()
+	for _, slug := range []string{"cf", "dabs"} {
+		if err := os.MkdirAll(filepath.Join(localRoot, slug, "addons"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(localRoot, slug, "addons", slug+".pbo"), []byte("pbo"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Config{
+		Paths:       config.PathsConfig{LocalModsRoot: localRoot, LocalCacheRoot: t.TempDir()},
+		Shutdown:    config.ShutdownConfig{GracePeriodSeconds: 60},
+		Concurrency: config.ConcurrencyConfig{SFTPSyncParallelismModsPerServer: 2},
+		Sync:        config.SyncConfig{FileWorkersPerMod: 1},
+	}
+	server := config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{Auth: config.SFTPAuthConfig{Type: "password"}, RemoteModsRoot: "/mods", MaxRetries: 1, ConnectTimeoutSeconds: 1, OperationTimeoutSeconds: 5}}
+	mods := map[string]state.ModState{
+		"1": {FolderSlug: "cf", LocalUpdatedAt: now},
+		"2": {FolderSlug: "dabs", LocalUpdatedAt: now},
+	}
+	srv := state.ServerState{LastModIDs: []string{"1", "2"}, NeedsModUpdate: true}
+	var logs bytes.Buffer
+	engine := NewEngine().WithLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+	engine.now = func() time.Time { return now }
+
+	updated, err := engine.syncServer(context.Background(), cfg, server, mods, srv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Stage != state.StageCountdown || updated.LastError != "" {
+		t.Fatalf("expected sync to proceed without the preflight, got %#v", updated)
+	}
+	if n := strings.Count(logs.String(), "sftp remote disk preflight skipped"); n != 1 {
+		t.Fatalf("expected one skipped preflight log, got %d:\n%s", n, logs.String())
+	}
+}
+
+func TestSyncServerBlocksModsThatFailedValidation(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	cfg := config.Config{
+		Paths:       config.PathsConfig{LocalModsRoot: t.TempDir(), LocalCacheRoot: t.TempDir()},
+		Concurrency: config.ConcurrencyConfig{SFTPSyncParallelismModsPerServer: 1},
+	}
+	server := config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{RemoteModsRoot: "/mods"}}
+	mods := map[string]state.ModState{
+		"1": {FolderSlug: "cf", LocalUpdatedAt: now, ValidationError: "addons/cf.pbo: missing .bisign"},
+	}
+	engine := NewEngine()
+	engine.now = func() time.Time { return now }
+
+	updated, err := engine.syncServer(context.Background(), cfg, server, mods, state.ServerState{LastModIDs: []string{"1"}, NeedsModUpdate: true}, nil)
+	if err == nil {
+		t.Fatal("expected sync to be blocked")
+	}
+	if updated.Stage != state.StageError || updated.LastErrorStage != "validate_content" || !updated.NeedsModUpdate {
+		t.Fatalf("unexpected server state: %#v", updated)
+	}
+	if len(updated.SyncedMods) != 0 {
+		t.Fatalf("expected nothing synced, got %#v", updated.SyncedMods)
+	}
+}
+
+func TestSyncServersDeepVerifiesWithoutPendingUpdate(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	localRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(localRoot, "cf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	server := config.ServerConfig{ID: "s1", SFTP: config.ServerSFTPConfig{Auth: config.SFTPAuthConfig{Type: "password"}, RemoteModsRoot: "/mods", MaxRetries: 1, ConnectTimeoutSeconds: 1, OperationTimeoutSeconds: 5}}
+	cfg := config.Config{
+		Paths:       config.PathsConfig{LocalModsRoot: localRoot, LocalCacheRoot: t.TempDir()},
+		Shutdown:    config.ShutdownConfig{GracePeriodSeconds: 60},
+		Concurrency: config.ConcurrencyConfig{SFTPSyncParallelismServers: 1, SFTPSyncParallelismModsPerServer: 1},
+		Sync:        config.SyncConfig{RemoteListing: config.RemoteListingManifest, DeepVerifyHours: 24},
+		Servers:     []config.ServerConfig{server},
+	}
+	st := state.State{
+		Mods: map[string]state.ModState{"1": {FolderSlug: "cf", LocalUpdatedAt: now.Add(-time.Hour)}},
+		Servers: map[string]state.ServerState{"s1": {
+			LastModIDs:       []string{"1"},
+			Stage:            state.StageIdle,
+			SyncedMods:       map[string]time.Time{"1": now.Add(-time.Hour)},
+			LastDeepVerifyAt: map[string]time.Time{"1": now.Add(-25 * time.Hour)},
+		}},
+	}
+	engine := NewEngine()
+	engine.now = func() time.Time { return now }
+
+	if err := engine.SyncServers(context.Background(), cfg, &st); err != nil {
+		t.Fatal(err)
+	}
+	srv := st.Servers["s1"]
+	if !srv.LastDeepVerifyAt["1"].Equal(now) {
+		t.Fatalf("expected due deep verify without a pending update, got %#v", srv.LastDeepVerifyAt)
+	}
+	if srv.Stage != state.StageIdle || srv.NeedsShutdown {
+		t.Fatalf("verify without changes must not start a countdown: %#v", srv)
+	}
+	if deepVerifyDue(cfg, srv, now) {
+		t.Fatal("expected deep verify to be done until the next period")
+	}
+}
+
+func TestReuseManifestHashesForUnchangedFiles(t *testing.T) {
+	tree := map[string]treeEntry{
+		"a.pbo": {Path: "a.pbo", Size: 10, MTime: 100},
+		"b.pbo": {Path: "b.pbo", Size: 20, MTime: 200},
+	}
+	manifest := remoteManifest{Files: map[string]manifestEntry{
+		"a.pbo": {Size: 10, MTime: 100, SHA256: "aa"},
+		"b.pbo": {Size: 20, MTime: 199, SHA256: "bb"},
+	}}
+	reuseManifestHashes(tree, manifest)
+	if tree["a.pbo"].Hash != "aa" || tree["b.pbo"].Hash != "" {
+		t.Fatalf("unexpected hashes: %#v", tree)
+	}
+}
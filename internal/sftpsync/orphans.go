@@ -0,0 +1,92 @@
+package sftpsync
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+	"github.com/pkg/sftp"
+)
+
+type orphanFolder struct {
+	slug  string
+	modID string
+}
+
+// findOrphans returns folders the daemon created under remote_mods_root that
+// no mod on the server's current modlist maps to any more, either because the
+// mod was removed or because its folder slug changed.
+func findOrphans(owned map[string]string, lastModIDs []string, mods map[string]state.ModState) []orphanFolder {
+	inUse := make(map[string]struct{}, len(lastModIDs))
+	for _, id := range lastModIDs {
+		if slug := mods[id].FolderSlug; slug != "" {
+			inUse[slug] = struct{}{}
+		}
+	}
+	orphans := make([]orphanFolder, 0)
+	for slug, id := range owned {
+		if _, ok := inUse[slug]; ok {
+			continue
+		}
+		orphans = append(orphans, orphanFolder{slug: slug, modID: id})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].slug < orphans[j].slug })
+	return orphans
+}
+
+// removeOrphan deletes an orphaned mod folder. Paths the mod's sync rules keep
+// (protected, excluded or outside the include scope) are left in place along
+// with their parent directories; the folder itself is only removed once empty.
+func removeOrphan(client *sftp.Client, root string, rules syncRules) (deleted int, kept int, err error) {
+	tree, exists, err := buildRemoteTree(client, root)
+	if err != nil {
+		return 0, 0, fmt.Errorf("walk orphan folder: %w", err)
+	}
+	if !exists {
+		return 0, 0, nil
+	}
+	keep := rules.keptRemote(tree)
+	files := make([]treeEntry, 0, len(tree))
+	dirs := make([]treeEntry, 0)
+	for rel, entry := range tree {
+		if _, ok := keep[rel]; ok {
+			continue
+		}
+		if entry.IsDir {
+			dirs = append(dirs, entry)
+		} else {
+			files = append(files, entry)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	sort.Slice(dirs, func(i, j int) bool {
+		if pathDepth(dirs[i].Path) == pathDepth(dirs[j].Path) {
+			return dirs[i].Path < dirs[j].Path
+		}
+		return pathDepth(dirs[i].Path) > pathDepth(dirs[j].Path)
+	})
+
+	if err := client.Remove(path.Join(root, remoteManifestName)); err != nil && !isNotExist(err) {
+		return deleted, len(keep), fmt.Errorf("delete manifest: %w", err)
+	}
+	for _, file := range files {
+		if err := client.Remove(path.Join(root, file.Path)); err != nil {
+			return deleted, len(keep), fmt.Errorf("delete %s: %w", file.Path, err)
+		}
+		deleted++
+	}
+	for _, dir := range dirs {
+		if err := client.RemoveDirectory(path.Join(root, dir.Path)); err != nil {
+			return deleted, len(keep), fmt.Errorf("delete dir %s: %w", dir.Path, err)
+		}
+		deleted++
+	}
+	if len(keep) > 0 {
+		return deleted, len(keep), nil
+	}
+	if err := client.RemoveDirectory(root); err != nil {
+		return deleted, 0, fmt.Errorf("delete folder: %w", err)
+	}
+	return deleted, 0, nil
+}
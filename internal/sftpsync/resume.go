@@ -0,0 +1,230 @@
+package sftpsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+	"github.com/pkg/sftp"
+)
+
+var tmpSuffixPattern = regexp.MustCompile(`\.tmp-[0-9a-f]+$`)
+
+// uploadJournal tracks in-flight temp uploads keyed by final remote path so an
+// interrupted upload can be resumed on the next sync instead of restarted.
+// With a path set, every change is written to that file right away, so a
+// crash mid-sync cannot leave a temp file the journal does not know about.
+type uploadJournal struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]state.PartialUpload
+}
+
+func newUploadJournal(entries map[string]state.PartialUpload) *uploadJournal {
+	j := &uploadJournal{entries: make(map[string]state.PartialUpload, len(entries))}
+	for k, v := range entries {
+		j.entries[k] = v
+	}
+	return j
+}
+
+// loadUploadJournal reads the journal file at path. It falls back to entries,
+// the copy kept in state, when the file does not exist yet.
+func loadUploadJournal(path string, entries map[string]state.PartialUpload) (*uploadJournal, error) {
+	b, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read upload journal: %w", err)
+	default:
+		entries = nil
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return nil, fmt.Errorf("parse upload journal: %w", err)
+		}
+	}
+	j := newUploadJournal(entries)
+	j.path = path
+	return j, nil
+}
+
+// persist writes the journal file; callers hold j.mu.
+func (j *uploadJournal) persist() error {
+	if j.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(j.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func (j *uploadJournal) get(remotePath string) (state.PartialUpload, bool) {
+	if j == nil {
+		return state.PartialUpload{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p, ok := j.entries[remotePath]
+	return p, ok
+}
+
+// put records an upload before its temp file is written.
+func (j *uploadJournal) put(remotePath string, p state.PartialUpload) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[remotePath] = p
+	if err := j.persist(); err != nil {
+		delete(j.entries, remotePath)
+		return fmt.Errorf("persist upload journal: %w", err)
+	}
+	return nil
+}
+
+// remove forgets an upload. A failed write only leaves a stale entry, which
+// the next sync drops, so it is not reported.
+func (j *uploadJournal) remove(remotePath string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[remotePath]; !ok {
+		return
+	}
+	delete(j.entries, remotePath)
+	_ = j.persist()
+}
+
+func (j *uploadJournal) snapshot() map[string]state.PartialUpload {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) == 0 {
+		return nil
+	}
+	out := make(map[string]state.PartialUpload, len(j.entries))
+	for k, v := range j.entries {
+		out[k] = v
+	}
+	return out
+}
+
+// underRoot returns the journal entries for files inside remoteModPath.
+func (j *uploadJournal) underRoot(remoteModPath string) map[string]state.PartialUpload {
+	out := map[string]state.PartialUpload{}
+	if j == nil {
+		return out
+	}
+	prefix := strings.TrimSuffix(remoteModPath, "/") + "/"
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for k, v := range j.entries {
+		if strings.HasPrefix(k, prefix) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func tempUploadPath(remotePath string, size int64, mtime time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", remotePath, size, mtime.UTC().Unix())))
+	return remotePath + ".tmp-" + hex.EncodeToString(sum[:6])
+}
+
+// pruneTempFiles removes upload temp files from remoteTree. Temp files recorded
+// in the journal are kept for resumption; the rest are returned as stale.
+func pruneTempFiles(remoteTree map[string]treeEntry, journal *uploadJournal, remoteModPath string) []treeEntry {
+	live := map[string]struct{}{}
+	for _, p := range journal.underRoot(remoteModPath) {
+		live[p.TmpPath] = struct{}{}
+	}
+	stale := make([]treeEntry, 0)
+	for rel, entry := range remoteTree {
+		if entry.IsDir || !tmpSuffixPattern.MatchString(rel) {
+			continue
+		}
+		delete(remoteTree, rel)
+		if _, ok := live[path.Join(remoteModPath, rel)]; !ok {
+			stale = append(stale, entry)
+		}
+	}
+	return stale
+}
+
+// dropStaleJournalEntries forgets partial uploads inside remoteModPath that no
+// longer match a planned upload and deletes their temp files.
+func dropStaleJournalEntries(client *sftp.Client, journal *uploadJournal, remoteModPath string, uploads []treeEntry) {
+	planned := make(map[string]treeEntry, len(uploads))
+	for _, u := range uploads {
+		planned[path.Join(remoteModPath, u.Path)] = u
+	}
+	for remotePath, p := range journal.underRoot(remoteModPath) {
+		if u, ok := planned[remotePath]; ok && u.Size == p.Size && u.MTime == p.MTime {
+			continue
+		}
+		_ = client.Remove(p.TmpPath)
+		journal.remove(remotePath)
+	}
+}
+
+// resumeOffset returns how many bytes of tmpPath can be kept. The partial file
+// must be no larger than the source and its whole content must hash the same
+// as the local file's prefix of that length; otherwise the upload restarts
+// from zero.
+func resumeOffset(client *sftp.Client, src io.ReaderAt, tmpPath string, size int64) int64 {
+	info, err := client.Stat(tmpPath)
+	if err != nil {
+		return 0
+	}
+	partial := info.Size()
+	if partial <= 0 || partial > size {
+		return 0
+	}
+	remote, err := client.OpenFile(tmpPath, os.O_RDONLY)
+	if err != nil {
+		return 0
+	}
+	defer remote.Close()
+	if !prefixMatches(remote, src, partial) {
+		return 0
+	}
+	return partial
+}
+
+// prefixMatches streams n bytes of remote and of local through SHA-256 and
+// compares the sums.
+func prefixMatches(remote io.Reader, local io.ReaderAt, n int64) bool {
+	remoteSum := sha256.New()
+	if copied, err := io.Copy(remoteSum, io.LimitReader(remote, n)); err != nil || copied != n {
+		return false
+	}
+	localSum := sha256.New()
+	if copied, err := io.Copy(localSum, io.NewSectionReader(local, 0, n)); err != nil || copied != n {
+		return false
+	}
+	return bytes.Equal(remoteSum.Sum(nil), localSum.Sum(nil))
+}
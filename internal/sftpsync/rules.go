@@ -0,0 +1,114 @@
+package sftpsync
+
+import (
+	"path"
+	"strings"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+)
+
+// syncRules holds the merged include/exclude/protect globs for one mod folder.
+// Patterns without a slash match any path segment (like .gitignore), patterns
+// with a slash match the mod-relative path; a match on a directory covers
+// everything below it.
+type syncRules struct {
+	include []string
+	exclude []string
+	protect []string
+}
+
+func newSyncRules(sets ...config.SyncRulesConfig) syncRules {
+	var rules syncRules
+	for _, set := range sets {
+		rules.include = append(rules.include, set.Include...)
+		rules.exclude = append(rules.exclude, set.Exclude...)
+		rules.protect = append(rules.protect, set.Protect...)
+	}
+	return rules
+}
+
+func (r syncRules) excluded(rel string) bool {
+	return matchAny(r.exclude, rel)
+}
+
+func (r syncRules) included(rel string) bool {
+	return len(r.include) == 0 || matchAny(r.include, rel)
+}
+
+func (r syncRules) protected(rel string) bool {
+	return matchAny(r.protect, rel)
+}
+
+// filterLocal drops local entries that must never be uploaded. With include
+// rules, directories survive only when they match or hold an included file.
+func (r syncRules) filterLocal(tree map[string]treeEntry) map[string]treeEntry {
+	if len(r.include) == 0 && len(r.exclude) == 0 {
+		return tree
+	}
+	out := make(map[string]treeEntry, len(tree))
+	for rel, entry := range tree {
+		if r.excluded(rel) {
+			continue
+		}
+		if entry.IsDir && len(r.include) > 0 && !r.included(rel) {
+			continue
+		}
+		if !entry.IsDir && !r.included(rel) {
+			continue
+		}
+		out[rel] = entry
+		if len(r.include) > 0 {
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				if parent, ok := tree[dir]; ok && !r.excluded(dir) {
+					out[dir] = parent
+				}
+			}
+		}
+	}
+	return out
+}
+
+// keptRemote returns remote paths that must survive the sync: protected paths,
+// paths outside the include/exclude scope, and every directory above them.
+func (r syncRules) keptRemote(tree map[string]treeEntry) map[string]struct{} {
+	kept := map[string]struct{}{}
+	for rel, entry := range tree {
+		if r.protected(rel) || r.excluded(rel) || (!entry.IsDir && !r.included(rel)) {
+			kept[rel] = struct{}{}
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				kept[dir] = struct{}{}
+			}
+		}
+	}
+	return kept
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range strings.Split(rel, "/") {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for p := rel; p != "." && p != ""; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
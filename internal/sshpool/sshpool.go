@@ -0,0 +1,345 @@
+package sshpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const keepaliveRequest = "keepalive@openssh.com"
+
+// Pool keeps one SSH connection and one SFTP session per server and hands
+// them out to modlist polling and sync. Connections are health-checked with
+// keepalives, redialed when broken, and closed after sitting idle. A nil Pool
+// dials a fresh connection per Acquire and closes it on Release.
+type Pool struct {
+	mu        sync.Mutex
+	conns     map[string]*conn
+	keepalive time.Duration
+	idleClose time.Duration
+	now       func() time.Time
+	dial      func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error)
+	opts      []sftp.ClientOption
+}
+
+type conn struct {
+	ssh       *ssh.Client
+	sftp      *sftp.Client
+	lastUsed  time.Time
+	lastAlive time.Time
+	inUse     int
+	broken    bool
+}
+
+// Lease is a borrowed connection. Release must be called exactly once.
+type Lease struct {
+	SSH  *ssh.Client
+	SFTP *sftp.Client
+
+	pool     *Pool
+	serverID string
+	conn     *conn
+}
+
+// New creates a pool; opts configure every SFTP session it opens.
+func New(keepalive, idleClose time.Duration, opts ...sftp.ClientOption) *Pool {
+	return &Pool{
+		opts:      opts,
+		conns:     map[string]*conn{},
+		keepalive: keepalive,
+		idleClose: idleClose,
+		now:       time.Now,
+		dial:      ssh.Dial,
+	}
+}
+
+// Acquire returns a healthy connection for srv, reusing the pooled one when
+// it still answers keepalives. Dialing is bounded by ctx and
+// sftp.connect_timeout_seconds and is attempted once; callers own retries.
+func (p *Pool) Acquire(ctx context.Context, srv config.ServerConfig) (*Lease, error) {
+	if p == nil {
+		c, err := dialServer(ctx, ssh.Dial, srv)
+		if err != nil {
+			return nil, err
+		}
+		return &Lease{SSH: c.ssh, SFTP: c.sftp, serverID: srv.ID, conn: c}, nil
+	}
+
+	p.mu.Lock()
+	c := p.conns[srv.ID]
+	if c != nil && c.broken {
+		if c.inUse <= 0 {
+			p.dropLocked(srv.ID, c)
+		}
+		c = nil
+	}
+	var check bool
+	if c != nil {
+		c.inUse++
+		c.lastUsed = p.now()
+		check = p.now().Sub(c.lastAlive) >= p.keepalive
+	}
+	p.mu.Unlock()
+	if c != nil {
+		lease := &Lease{SSH: c.ssh, SFTP: c.sftp, pool: p, serverID: srv.ID, conn: c}
+		if !check {
+			return lease, nil
+		}
+		err := p.ping(c)
+		if err == nil {
+			return lease, nil
+		}
+		lease.Release(err)
+	}
+
+	fresh, err := dialServer(ctx, p.dial, srv, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing := p.conns[srv.ID]; existing != nil && !existing.broken {
+		fresh.close()
+		existing.inUse++
+		existing.lastUsed = p.now()
+		return &Lease{SSH: existing.ssh, SFTP: existing.sftp, pool: p, serverID: srv.ID, conn: existing}, nil
+	}
+	fresh.lastUsed = p.now()
+	fresh.lastAlive = p.now()
+	fresh.inUse = 1
+	p.conns[srv.ID] = fresh
+	return &Lease{SSH: fresh.ssh, SFTP: fresh.sftp, pool: p, serverID: srv.ID, conn: fresh}, nil
+}
+
+// Release returns the connection to the pool. A non-nil err marks it broken
+// so the next Acquire reconnects instead of reusing a half-dead session.
+func (l *Lease) Release(err error) {
+	if l.pool == nil {
+		l.conn.close()
+		return
+	}
+	p := l.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l.conn.inUse--
+	l.conn.lastUsed = p.now()
+	if err != nil {
+		l.conn.broken = true
+	}
+	if l.conn.broken && l.conn.inUse <= 0 {
+		p.dropLocked(l.serverID, l.conn)
+	}
+}
+
+// ConnectionBroken reports whether err came from the SSH/SFTP transport, in
+// which case the connection must not be reused. Remote filesystem errors such
+// as a missing file leave the session usable.
+func ConnectionBroken(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+// Sweep closes connections unused for longer than the idle timeout and pings
+// the remaining ones, dropping those that fail their keepalive.
+func (p *Pool) Sweep() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	now := p.now()
+	due := make([]*conn, 0)
+	for id, c := range p.conns {
+		if c.inUse > 0 {
+			continue
+		}
+		if c.broken || now.Sub(c.lastUsed) >= p.idleClose {
+			p.dropLocked(id, c)
+			continue
+		}
+		if now.Sub(c.lastAlive) >= p.keepalive {
+			due = append(due, c)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, c := range due {
+		err := p.ping(c)
+		p.mu.Lock()
+		if err != nil {
+			c.broken = true
+			for id, pooled := range p.conns {
+				if pooled == c && c.inUse <= 0 {
+					p.dropLocked(id, c)
+				}
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// ping sends an OpenSSH keepalive. A peer that does not answer within the
+// keepalive interval is treated as dead.
+func (p *Pool) ping(c *conn) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := c.ssh.SendRequest(keepaliveRequest, true, nil)
+		errCh <- err
+	}()
+	timeout := p.keepalive
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("ssh keepalive: %w", err)
+		}
+		p.mu.Lock()
+		c.lastAlive = p.now()
+		p.mu.Unlock()
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("ssh keepalive timed out")
+	}
+}
+
+// Run sweeps every keepalive interval until ctx is done.
+func (p *Pool) Run(ctx context.Context) {
+	if p == nil || p.keepalive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Sweep()
+		}
+	}
+}
+
+// Close closes every pooled connection.
+func (p *Pool) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, c := range p.conns {
+		p.dropLocked(id, c)
+	}
+	return nil
+}
+
+// Len reports how many connections are pooled.
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+func (p *Pool) dropLocked(serverID string, c *conn) {
+	if p.conns[serverID] == c {
+		delete(p.conns, serverID)
+	}
+	c.close()
+}
+
+func (c *conn) close() {
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	if c.ssh != nil {
+		c.ssh.Close()
+	}
+}
+
+func dialServer(ctx context.Context, dial func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error), srv config.ServerConfig, opts ...sftp.ClientOption) (*conn, error) {
+	sshConfig, err := ClientConfig(srv)
+	if err != nil {
+		return nil, err
+	}
+	addr := fmt.Sprintf("%s:%d", srv.SFTP.Host, srv.SFTP.Port)
+	type result struct {
+		conn *ssh.Client
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		c, err := dial("tcp", addr, sshConfig)
+		resCh <- result{conn: c, err: err}
+	}()
+
+	var timeout <-chan time.Time
+	if srv.SFTP.ConnectTimeoutSeconds > 0 {
+		timer := time.NewTimer(time.Duration(srv.SFTP.ConnectTimeoutSeconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, fmt.Errorf("sftp connect to server %q timed out", srv.ID)
+	case res := <-resCh:
+		if res.err != nil {
+			return nil, fmt.Errorf("dial sftp ssh for server %q: %w", srv.ID, res.err)
+		}
+		client, err := sftp.NewClient(res.conn, opts...)
+		if err != nil {
+			res.conn.Close()
+			return nil, fmt.Errorf("create sftp client for server %q: %w", srv.ID, err)
+		}
+		return &conn{ssh: res.conn, sftp: client}, nil
+	}
+}
+
+// ClientConfig builds the SSH client config for a server's SFTP settings.
+func ClientConfig(srv config.ServerConfig) (*ssh.ClientConfig, error) {
+	authMethods := make([]ssh.AuthMethod, 0, 1)
+	switch srv.SFTP.Auth.Type {
+	case "password":
+		authMethods = append(authMethods, ssh.Password(srv.SFTP.Auth.Password))
+	case "private_key":
+		keyBytes, err := os.ReadFile(srv.SFTP.Auth.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read private key for server %q: %w", srv.ID, err)
+		}
+		signer, err := ssh.ParsePrivateKey(keyBytes)
+		if err != nil && srv.SFTP.Auth.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(srv.SFTP.Auth.Passphrase))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse private key for server %q: %w", srv.ID, err)
+		}
+		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	default:
+		return nil, fmt.Errorf("unsupported sftp auth type %q for server %q", srv.SFTP.Auth.Type, srv.ID)
+	}
+	return &ssh.ClientConfig{
+		User:            srv.SFTP.User,
+		Auth:            authMethods,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}, nil
+}
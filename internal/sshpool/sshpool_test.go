@@ -0,0 +1,157 @@
+package sshpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func testServer(id string) config.ServerConfig {
+	return config.ServerConfig{ID: id, SFTP: config.ServerSFTPConfig{
+		Host: "h", Port: 22, User: "u",
+		Auth:                  config.SFTPAuthConfig{Type: "password", Password: "p"},
+		ConnectTimeoutSeconds: 5,
+	}}
+}
+
+func testPool(now *time.Time, dials *int) *Pool {
+	p := New(30*time.Second, 5*time.Minute)
+	p.now = func() time.Time { return *now }
+	p.dial = func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+		*dials++
+		return &ssh.Client{}, nil
+	}
+	return p
+}
+
+func TestAcquireReusesConnection(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	dials := 0
+	p := testPool(&now, &dials)
+	for i := 0; i < 3; i++ {
+		lease, err := p.Acquire(context.Background(), testServer("s1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lease.Release(nil)
+		now = now.Add(time.Minute)
+	}
+	if dials != 1 || p.Len() != 1 {
+		t.Fatalf("expected one pooled connection, got dials=%d len=%d", dials, p.Len())
+	}
+	if _, err := p.Acquire(context.Background(), testServer("s2")); err != nil {
+		t.Fatal(err)
+	}
+	if dials != 2 || p.Len() != 2 {
+		t.Fatalf("expected a connection per server, got dials=%d len=%d", dials, p.Len())
+	}
+}
+
+func TestReleaseWithErrorForcesReconnect(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	dials := 0
+	p := testPool(&now, &dials)
+	first, err := p.Acquire(context.Background(), testServer("s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Acquire(context.Background(), testServer("s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Release(errors.New("connection reset"))
+	if p.Len() != 1 {
+		t.Fatalf("expected broken connection to stay while still leased")
+	}
+	second.Release(nil)
+	if p.Len() != 0 {
+		t.Fatalf("expected broken connection to be dropped once released")
+	}
+	third, err := p.Acquire(context.Background(), testServer("s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	third.Release(nil)
+	if dials != 2 {
+		t.Fatalf("expected reconnect after broken release, got %d dials", dials)
+	}
+}
+
+func TestSweepClosesIdleConnections(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	dials := 0
+	p := testPool(&now, &dials)
+	busy, err := p.Acquire(context.Background(), testServer("busy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := p.Acquire(context.Background(), testServer("idle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle.Release(nil)
+
+	now = now.Add(time.Minute)
+	p.Sweep()
+	if p.Len() != 2 {
+		t.Fatalf("expected connections to survive before idle timeout, got %d", p.Len())
+	}
+	now = now.Add(5 * time.Minute)
+	p.Sweep()
+	if p.Len() != 1 {
+		t.Fatalf("expected idle connection to be closed and leased one kept, got %d", p.Len())
+	}
+	busy.Release(nil)
+}
+
+func TestNilPoolDialsPerLease(t *testing.T) {
+	var p *Pool
+	lease, err := p.Acquire(context.Background(), testServer("s1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease.Release(nil)
+	if p.Len() != 0 {
+		t.Fatalf("nil pool should not retain connections")
+	}
+}
+
+func TestClientConfigRejectsUnknownAuth(t *testing.T) {
+	srv := testServer("s1")
+	srv.SFTP.Auth.Type = "kerberos"
+	if _, err := ClientConfig(srv); err == nil {
+		t.Fatal("expected unsupported auth type error")
+	}
+}
+
+func TestConnectionBrokenOnlyForTransportErrors(t *testing.T) {
+	broken := []error{
+		fmt.Errorf("upload a.pbo: %w", sftp.ErrSSHFxConnectionLost),
+		fmt.Errorf("build remote tree: %w", io.EOF),
+		fmt.Errorf("upload a.pbo: %w", context.DeadlineExceeded),
+		fmt.Errorf("mkdir x: %w", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}),
+	}
+	for _, err := range broken {
+		if !ConnectionBroken(err) {
+			t.Fatalf("expected %v to mark the connection broken", err)
+		}
+	}
+	healthy := []error{
+		fmt.Errorf("delete extra file a: %w", os.ErrPermission),
+		fmt.Errorf("build local tree: %w", os.ErrNotExist),
+	}
+	for _, err := range healthy {
+		if ConnectionBroken(err) {
+			t.Fatalf("expected %v to keep the connection", err)
+		}
+	}
+}
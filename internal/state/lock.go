@@ -0,0 +1,42 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned by Lock while another process holds the state lock.
+var ErrLocked = errors.New("state is locked by another process")
+
+// ProcessLock is an exclusive lock on <state_path>.lock held by the daemon and
+// by commands that write state, so two processes never rewrite it at once.
+type ProcessLock struct {
+	f *os.File
+}
+
+// Lock takes the lock for the state file at statePath without waiting.
+func Lock(statePath string) (*ProcessLock, error) {
+	path := statePath + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("ensure state dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open state lock: %w", err)
+	}
+	if err := tryLock(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return &ProcessLock{f: f}, nil
+}
+
+// Unlock releases the lock; the lock file is left in place.
+func (l *ProcessLock) Unlock() error {
+	return l.f.Close()
+}
@@ -21,11 +21,44 @@ const (
 	StageError         Stage = "error"
 )
 
+type CountdownNotice string
+
+const (
+	CountdownNoticeRestarted CountdownNotice = "restarted"
+	CountdownNoticeExtended  CountdownNotice = "extended"
+	CountdownNoticeMerged    CountdownNotice = "merged"
+)
+
 type State struct {
 	Version   int                    `json:"version"`
 	UpdatedAt time.Time              `json:"updated_at"`
 	Mods      map[string]ModState    `json:"mods"`
 	Servers   map[string]ServerState `json:"servers"`
+	Steam     SteamState             `json:"steam"`
+}
+
+// SteamState holds SteamCMD conditions that hold back downloads.
+type SteamState struct {
+	// Accounts is keyed by Steam login ("anonymous" for anonymous login).
+	Accounts        map[string]SteamAccountState `json:"accounts,omitempty"`
+	LastFailureKind string                       `json:"last_failure_kind,omitempty"`
+	LastFailureAt   *time.Time                   `json:"last_failure_at,omitempty"`
+	HangCount       int                          `json:"hang_count,omitempty"`
+	LastHangAt      *time.Time                   `json:"last_hang_at,omitempty"`
+}
+
+type SteamAccountState struct {
+	LoginBlocked  *LoginBlock `json:"login_blocked,omitempty"`
+	CooldownUntil *time.Time  `json:"cooldown_until,omitempty"`
+	LastUsedAt    *time.Time  `json:"last_used_at,omitempty"`
+}
+
+// LoginBlock is recorded when Steam rejected an account's password; it lasts
+// until the account's credentials in the config change.
+type LoginBlock struct {
+	At                     time.Time `json:"at"`
+	Reason                 string    `json:"reason,omitempty"`
+	CredentialsFingerprint string    `json:"credentials_fingerprint"`
 }
 
 type ModState struct {
@@ -33,25 +66,71 @@ type ModState struct {
 	FolderSlug          string    `json:"folder_slug"`
 	WorkshopUpdatedAt   time.Time `json:"workshop_updated_at"`
 	LastWorkshopCheckAt time.Time `json:"last_workshop_check_at"`
+	LastWorkshopError   string    `json:"last_workshop_error,omitempty"`
 	LocalUpdatedAt      time.Time `json:"local_updated_at"`
 	LastSyncedAt        time.Time `json:"last_synced_at,omitempty"`
 	LastTitle           string    `json:"last_title,omitempty"`
+	FileSize            int64     `json:"file_size,omitempty"`
+	WorkshopCreatedAt   time.Time `json:"workshop_created_at,omitempty"`
+	PreviewURL          string    `json:"preview_url,omitempty"`
+	Tags                []string  `json:"tags,omitempty"`
+	ChildIDs            []string  `json:"children,omitempty"`
+	Banned              bool      `json:"banned,omitempty"`
+	BanReason           string    `json:"ban_reason,omitempty"`
+	Visibility          int       `json:"visibility,omitempty"`
+	WorkshopRevision    int64     `json:"workshop_revision,omitempty"`
+	Changelog           string    `json:"changelog,omitempty"`
+	// ChangelogUpdatedAt is the Workshop time_updated Changelog belongs to.
+	ChangelogUpdatedAt time.Time  `json:"changelog_updated_at,omitempty"`
+	ChangelogCheckedAt time.Time  `json:"changelog_checked_at,omitempty"`
+	ValidationError    string     `json:"validation_error,omitempty"`
+	RequiresLogin      bool       `json:"requires_login,omitempty"`
+	UnreferencedSince  *time.Time `json:"unreferenced_since,omitempty"`
 }
 
 type ServerState struct {
-	LastModIDs         []string             `json:"last_mod_ids"`
-	LastModsetHash     string               `json:"last_modset_hash"`
-	NeedsModUpdate     bool                 `json:"needs_mod_update"`
-	NeedsShutdown      bool                 `json:"needs_shutdown"`
-	Stage              Stage                `json:"stage"`
-	SyncedMods         map[string]time.Time `json:"synced_mods"`
-	ShutdownDeadlineAt *time.Time           `json:"shutdown_deadline_at,omitempty"`
-	NextAnnounceAt     *time.Time           `json:"next_announce_at,omitempty"`
-	LastError          string               `json:"last_error,omitempty"`
-	LastErrorStage     string               `json:"last_error_stage,omitempty"`
-	LastErrorAt        *time.Time           `json:"last_error_at,omitempty"`
-	LastSuccessSyncAt  *time.Time           `json:"last_success_sync_at,omitempty"`
-	ShutdownSentAt     *time.Time           `json:"shutdown_sent_at,omitempty"`
+	LastModIDs         []string                 `json:"last_mod_ids"`
+	LastModsetHash     string                   `json:"last_modset_hash"`
+	ModlistStat        *RemoteFileStat          `json:"modlist_stat,omitempty"`
+	NeedsModUpdate     bool                     `json:"needs_mod_update"`
+	NeedsShutdown      bool                     `json:"needs_shutdown"`
+	Stage              Stage                    `json:"stage"`
+	SyncedMods         map[string]time.Time     `json:"synced_mods"`
+	LastDeepVerifyAt   map[string]time.Time     `json:"last_deep_verify_at,omitempty"`
+	PartialUploads     map[string]PartialUpload `json:"partial_uploads,omitempty"`
+	OwnedRemoteFolders map[string]string        `json:"owned_remote_folders,omitempty"`
+	ShutdownDeadlineAt *time.Time               `json:"shutdown_deadline_at,omitempty"`
+	NextAnnounceAt     *time.Time               `json:"next_announce_at,omitempty"`
+	CountdownNotice    CountdownNotice          `json:"countdown_notice,omitempty"`
+	PendingChanges     *ModsetChanges           `json:"pending_changes,omitempty"`
+	// UpdatedMods are the listed mods synced with a new version since the
+	// last restart.
+	UpdatedMods       []string   `json:"updated_mods,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastErrorStage    string     `json:"last_error_stage,omitempty"`
+	LastErrorAt       *time.Time `json:"last_error_at,omitempty"`
+	LastSuccessSyncAt *time.Time `json:"last_success_sync_at,omitempty"`
+	ShutdownSentAt    *time.Time `json:"shutdown_sent_at,omitempty"`
+}
+
+// ModsetChanges is the net set of workshop IDs added to and removed from a
+// server's modlist since its last restart.
+type ModsetChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// RemoteFileStat is the size and mtime (unix seconds) last seen for a remote file.
+type RemoteFileStat struct {
+	Size  int64 `json:"size"`
+	MTime int64 `json:"mtime"`
+}
+
+type PartialUpload struct {
+	TmpPath   string    `json:"tmp_path"`
+	Size      int64     `json:"size"`
+	MTime     int64     `json:"mtime"`
+	StartedAt time.Time `json:"started_at"`
 }
 
 type StateStore interface {
@@ -1,7 +1,9 @@
 package state
 
 import (
+	"errors"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -51,3 +53,25 @@ func TestFileStoreUpdate(t *testing.T) {
 		t.Fatal("expected mod in updated state")
 	}
 }
+
+func TestLockIsExclusive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("flock is unix only")
+	}
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+	lock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lock(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected second lock to fail with ErrLocked, got %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Lock(path)
+	if err != nil {
+		t.Fatalf("expected lock after unlock, got %v", err)
+	}
+	again.Unlock()
+}
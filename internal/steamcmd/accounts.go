@@ -0,0 +1,190 @@
+package steamcmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+const anonymousLogin = "anonymous"
+
+var unsafeLoginChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// account is one way of logging in to Steam.
+type account struct {
+	login    string
+	password string
+	// home is the HOME SteamCMD runs with, so the account's cached
+	// credentials are kept apart; empty keeps the SteamCMD default.
+	home string
+}
+
+func (a account) anonymous() bool {
+	return a.login == anonymousLogin
+}
+
+func (a account) fingerprint() string {
+	sum := sha256.Sum256([]byte(a.login + "\x00" + a.password))
+	return hex.EncodeToString(sum[:8])
+}
+
+// pool returns the configured login accounts in config order: steam.login
+// first (with SteamCMD's default home), then steam.accounts.
+func (r *CommandRunner) pool() []account {
+	accounts := make([]account, 0, len(r.cfg.Steam.Accounts)+1)
+	if r.cfg.Steam.Login != "" {
+		accounts = append(accounts, account{login: r.cfg.Steam.Login, password: r.cfg.Steam.Password})
+	}
+	for _, acct := range r.cfg.Steam.Accounts {
+		accounts = append(accounts, account{
+			login:    acct.Login,
+			password: acct.Password,
+			home:     filepath.Join(r.cfg.Paths.LocalCacheRoot, "steam-accounts", unsafeLoginChars.ReplaceAllString(acct.Login, "_")),
+		})
+	}
+	return accounts
+}
+
+// selectAccounts returns the accounts to try for modID, in order: anonymous
+// first when enabled and the mod is not known to need a login, then the
+// usable pool accounts (rotated for round_robin).
+func (r *CommandRunner) selectAccounts(st *state.State, modID string, now time.Time) ([]account, error) {
+	var candidates []account
+	if r.cfg.Steam.Anonymous && !st.Mods[modID].RequiresLogin {
+		candidates = append(candidates, account{login: anonymousLogin})
+	}
+	pool := r.pool()
+	if r.cfg.Steam.AccountStrategy == config.AccountStrategyRoundRobin && len(pool) > 1 {
+		start := r.nextAccount % len(pool)
+		r.nextAccount++
+		pool = append(append([]account{}, pool[start:]...), pool[:start]...)
+	}
+	candidates = append(candidates, pool...)
+
+	usable := candidates[:0]
+	var blocked, cooling int
+	for _, acct := range candidates {
+		switch r.accountStatus(st, acct, now) {
+		case accountBlocked:
+			blocked++
+		case accountCooling:
+			cooling++
+		default:
+			usable = append(usable, acct)
+		}
+	}
+	if len(usable) > 0 {
+		return usable, nil
+	}
+	switch {
+	case cooling > 0:
+		return nil, fmt.Errorf("steamcmd mod %s: %w", modID, ErrRateLimited)
+	case blocked > 0:
+		return nil, fmt.Errorf("steamcmd mod %s: %w", modID, ErrLoginBlocked)
+	}
+	return nil, &Failure{ModID: modID, Kind: FailureNoSubscription, Line: "mod requires a steam login but only anonymous login is configured"}
+}
+
+type accountAvailability int
+
+const (
+	accountUsable accountAvailability = iota
+	accountBlocked
+	accountCooling
+)
+
+// accountStatus reports whether acct may be used now. A login block for
+// credentials that changed since and an expired cooldown are cleared.
+func (r *CommandRunner) accountStatus(st *state.State, acct account, now time.Time) accountAvailability {
+	s, ok := st.Steam.Accounts[acct.login]
+	if !ok {
+		return accountUsable
+	}
+	status := accountUsable
+	if block := s.LoginBlocked; block != nil {
+		if block.CredentialsFingerprint == acct.fingerprint() {
+			status = accountBlocked
+		} else {
+			r.logger.Info("steam credentials changed, clearing login block", "account", acct.login, "blocked_at", block.At)
+			s.LoginBlocked = nil
+		}
+	}
+	if until := s.CooldownUntil; until != nil {
+		if now.Before(*until) {
+			if status == accountUsable {
+				status = accountCooling
+			}
+		} else {
+			s.CooldownUntil = nil
+		}
+	}
+	st.Steam.Accounts[acct.login] = s
+	return status
+}
+
+func (r *CommandRunner) updateAccount(st *state.State, acct account, fn func(*state.SteamAccountState)) {
+	if st.Steam.Accounts == nil {
+		st.Steam.Accounts = map[string]state.SteamAccountState{}
+	}
+	s := st.Steam.Accounts[acct.login]
+	fn(&s)
+	st.Steam.Accounts[acct.login] = s
+}
+
+// downloadMod runs SteamCMD for modID with each selected account until one
+// succeeds. An account whose password is rejected is blocked and one that is
+// rate limited cools down; both fail over to the next account. A mod that
+// fails anonymously is marked as requiring a login and is retried with the
+// pool. Any other failure is returned right away.
+func (r *CommandRunner) downloadMod(ctx context.Context, modID string, st *state.State) error {
+	now := time.Now().UTC()
+	accounts, err := r.selectAccounts(st, modID, now)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, acct := range accounts {
+		err := r.runSteamCMDWithRetry(ctx, modID, acct, st)
+		usedAt := time.Now().UTC()
+		r.updateAccount(st, acct, func(s *state.SteamAccountState) { s.LastUsedAt = &usedAt })
+		if err == nil {
+			return nil
+		}
+		var failure *Failure
+		if !errors.As(err, &failure) {
+			return err
+		}
+		lastErr = err
+		switch {
+		case failure.Kind == FailureInvalidPassword && !acct.anonymous():
+			r.updateAccount(st, acct, func(s *state.SteamAccountState) {
+				s.LoginBlocked = &state.LoginBlock{At: usedAt, Reason: failure.Line, CredentialsFingerprint: acct.fingerprint()}
+			})
+			r.logger.Warn("steam account blocked after invalid password", "account", acct.login, "mod_id", modID)
+		case failure.Kind == FailureRateLimited:
+			until := usedAt.Add(time.Duration(r.cfg.Steam.AccountCooldownMinutes) * time.Minute)
+			r.updateAccount(st, acct, func(s *state.SteamAccountState) { s.CooldownUntil = &until })
+			r.logger.Warn("steam account rate limited", "account", acct.login, "mod_id", modID, "cooldown_until", until)
+		case acct.anonymous() && failure.Kind == FailureNoSubscription:
+			mod := st.Mods[modID]
+			mod.RequiresLogin = true
+			st.Mods[modID] = mod
+			r.logger.Info("mod cannot be downloaded anonymously", "mod_id", modID, "failure_kind", string(failure.Kind))
+		case acct.anonymous() && failure.Kind == FailureGeneric:
+			// A plain "Failure" is often transient, so anonymous login is
+			// tried again next time.
+			r.logger.Info("anonymous download failed, trying accounts", "mod_id", modID, "failure_kind", string(failure.Kind))
+		default:
+			return err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,208 @@
+package steamcmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// selfUpdateExitCode is what SteamCMD returns after installing its own update
+// on the first run.
+const selfUpdateExitCode = 7
+
+// ensureInstalled installs SteamCMD when bootstrap is enabled and
+// paths.steamcmd_path does not exist yet.
+func (r *CommandRunner) ensureInstalled(ctx context.Context) error {
+	if !r.cfg.Steam.Bootstrap.Enabled {
+		return nil
+	}
+	if _, err := os.Stat(r.cfg.Paths.SteamcmdPath); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("stat steamcmd: %w", err)
+	}
+	start := time.Now()
+	if err := r.bootstrap(ctx); err != nil {
+		return fmt.Errorf("bootstrap steamcmd: %w", err)
+	}
+	r.logger.Info("steamcmd installed", "path", r.cfg.Paths.SteamcmdPath, "url", r.cfg.Steam.Bootstrap.URL, "duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+// bootstrap downloads the SteamCMD tarball from steam.steamcmd_bootstrap.url,
+// verifies its SHA-256, unpacks it into the directory of paths.steamcmd_path
+// and runs SteamCMD once so it updates itself.
+func (r *CommandRunner) bootstrap(ctx context.Context) error {
+	installDir := filepath.Dir(r.cfg.Paths.SteamcmdPath)
+	if err := os.MkdirAll(installDir, 0o755); err != nil {
+		return fmt.Errorf("ensure install dir: %w", err)
+	}
+	archive, err := os.CreateTemp(installDir, ".steamcmd-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("create download file: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := r.downloadTarball(ctx, archive); err != nil {
+		return err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := installTarball(archive, installDir, filepath.Base(r.cfg.Paths.SteamcmdPath)); err != nil {
+		return err
+	}
+	return r.selfUpdate(ctx)
+}
+
+func (r *CommandRunner) downloadTarball(ctx context.Context, dst io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.cfg.Steam.Bootstrap.URL, nil)
+	if err != nil {
+		return fmt.Errorf("build download request: %w", err)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download steamcmd: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download steamcmd: unexpected status %s", resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, h), resp.Body); err != nil {
+		return fmt.Errorf("download steamcmd: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, r.cfg.Steam.Bootstrap.SHA256) {
+		return fmt.Errorf("steamcmd tarball checksum mismatch: got sha256 %s, want %s", got, r.cfg.Steam.Bootstrap.SHA256)
+	}
+	return nil
+}
+
+// installTarball unpacks a gzipped tarball into a temporary directory inside
+// installDir and then renames its top-level entries into place, binary last,
+// so an interrupted install never leaves a binary that looks installed.
+func installTarball(r io.Reader, installDir, binary string) error {
+	tmp, err := os.MkdirTemp(installDir, ".steamcmd-unpack-")
+	if err != nil {
+		return fmt.Errorf("create unpack dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := untar(r, tmp); err != nil {
+		return fmt.Errorf("unpack steamcmd: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, binary)); err != nil {
+		return fmt.Errorf("steamcmd tarball does not contain %s", binary)
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == binary {
+			continue
+		}
+		target := filepath.Join(installDir, entry.Name())
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("replace %s: %w", entry.Name(), err)
+		}
+		if err := os.Rename(filepath.Join(tmp, entry.Name()), target); err != nil {
+			return fmt.Errorf("install %s: %w", entry.Name(), err)
+		}
+	}
+	if err := os.Rename(filepath.Join(tmp, binary), filepath.Join(installDir, binary)); err != nil {
+		return fmt.Errorf("install %s: %w", binary, err)
+	}
+	return nil
+}
+
+func untar(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe path %q in tarball", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %q (type %c) in tarball", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// selfUpdate runs "steamcmd +quit" once; on its first start SteamCMD
+// downloads and installs its own update.
+func (r *CommandRunner) selfUpdate(ctx context.Context) error {
+	if r.cfg.Steam.SteamCMDTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(r.cfg.Steam.SteamCMDTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	logFile, logPath, err := createModLog(r.cfg.Paths.LocalCacheRoot, "bootstrap", time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	defer pruneModLogs(r.cfg.Paths.LocalCacheRoot, "bootstrap", r.cfg.Steam.SteamCMDLogsPerMod)
+
+	cmd := exec.CommandContext(ctx, r.cfg.Paths.SteamcmdPath, "+quit")
+	startInProcessGroup(cmd)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.WaitDelay = 5 * time.Second
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == selfUpdateExitCode {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("steamcmd self-update (see %s): %w", logPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package steamcmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+// FailureKind classifies why a SteamCMD run did not download a mod.
+type FailureKind string
+
+const (
+	FailureTimeout         FailureKind = "timeout"
+	FailureGeneric         FailureKind = "failure"
+	FailureNoConnection    FailureKind = "no_connection"
+	FailureInvalidPassword FailureKind = "invalid_password"
+	FailureRateLimited     FailureKind = "rate_limited"
+	FailureNoSubscription  FailureKind = "no_subscription"
+	FailureDiskWrite       FailureKind = "disk_write"
+	FailureHung            FailureKind = "hung"
+	FailureUnknown         FailureKind = "unknown"
+)
+
+var (
+	// "ERROR! Download item 1559212036 failed (Timeout)"
+	itemFailurePattern     = regexp.MustCompile(`(?i)ERROR!\s+Download\s+item\s+([0-9]+)\s+failed\s+\(([^)]*)\)`)
+	invalidPasswordPattern = regexp.MustCompile(`(?i)Invalid\s+Password`)
+	rateLimitPattern       = regexp.MustCompile(`(?i)Rate\s+Limit\s+Exceeded`)
+	noSubscriptionPattern  = regexp.MustCompile(`(?i)No\s+subscription`)
+	diskWritePattern       = regexp.MustCompile(`(?i)Disk\s+write\s+fail`)
+)
+
+// retryPolicy is how UpdateMods reacts to a failure kind.
+type retryPolicy struct {
+	// retry runs SteamCMD again for the same mod (up to
+	// steamcmd_retries_per_mod attempts).
+	retry bool
+	// backoffFactor scales steamcmd_backoff_millis * attempt.
+	backoffFactor int
+	// stopBatch means the remaining mods would fail the same way.
+	stopBatch bool
+}
+
+var retryPolicies = map[FailureKind]retryPolicy{
+	// SteamCMD keeps partial downloads, so a retry resumes where it stopped.
+	FailureTimeout:      {retry: true, backoffFactor: 1},
+	FailureGeneric:      {retry: true, backoffFactor: 1},
+	FailureNoConnection: {retry: true, backoffFactor: 4, stopBatch: true},
+	FailureUnknown:      {retry: true, backoffFactor: 1},
+	// Killed by the watchdog; a new run resumes the partial download.
+	FailureHung: {retry: true, backoffFactor: 1},
+	// Block the account until its credentials in the config change.
+	FailureInvalidPassword: {stopBatch: true},
+	// Cool the account down for steam.account_cooldown_minutes.
+	FailureRateLimited:    {stopBatch: true},
+	FailureNoSubscription: {},
+	FailureDiskWrite:      {},
+}
+
+// Failure is a classified SteamCMD failure for one mod.
+type Failure struct {
+	ModID string
+	Kind  FailureKind
+	// Line is the (redacted) SteamCMD output line the kind was derived from.
+	Line string
+	Err  error
+}
+
+func (f *Failure) Error() string {
+	msg := fmt.Sprintf("steamcmd mod %s: %s", f.ModID, f.Kind)
+	if f.Line != "" {
+		msg += ": " + f.Line
+	}
+	if f.Err != nil {
+		msg += ": " + f.Err.Error()
+	}
+	return msg
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Retryable reports whether SteamCMD is run again for the same mod.
+func (f *Failure) Retryable() bool {
+	return retryPolicies[f.Kind].retry
+}
+
+// StopsBatch reports whether err means the remaining mods of a batch should
+// not be attempted: every account was rejected or rate limited, there is no
+// connection to Steam, or no account was usable to begin with
+// (ErrLoginBlocked, ErrRateLimited).
+func StopsBatch(err error) bool {
+	if errors.Is(err, ErrLoginBlocked) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var f *Failure
+	return errors.As(err, &f) && retryPolicies[f.Kind].stopBatch
+}
+
+// ModFailed reports whether err is a SteamCMD failure limited to one mod; the
+// runner has recorded it in state and other mods can still be downloaded.
+func ModFailed(err error) bool {
+	var f *Failure
+	return errors.As(err, &f) && !StopsBatch(err)
+}
+
+var (
+	ErrLoginBlocked = errors.New("all steam accounts blocked after invalid password; change their credentials in the config")
+	ErrRateLimited  = errors.New("all steam accounts rate limited")
+)
+
+// ParseFailure classifies SteamCMD output of a run for modID that did not
+// report success. Login failures take precedence over item failures; output
+// without any known failure line is FailureUnknown.
+func ParseFailure(logOutput, modID string) *Failure {
+	lines := strings.Split(logOutput, "\n")
+	for _, line := range lines {
+		switch {
+		case invalidPasswordPattern.MatchString(line):
+			return &Failure{ModID: modID, Kind: FailureInvalidPassword, Line: strings.TrimSpace(line)}
+		case rateLimitPattern.MatchString(line):
+			return &Failure{ModID: modID, Kind: FailureRateLimited, Line: strings.TrimSpace(line)}
+		}
+	}
+	for _, line := range lines {
+		if m := itemFailurePattern.FindStringSubmatch(line); m != nil && m[1] == modID {
+			return &Failure{ModID: modID, Kind: itemFailureKind(m[2]), Line: strings.TrimSpace(line)}
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case diskWritePattern.MatchString(line):
+			return &Failure{ModID: modID, Kind: FailureDiskWrite, Line: strings.TrimSpace(line)}
+		case noSubscriptionPattern.MatchString(line):
+			return &Failure{ModID: modID, Kind: FailureNoSubscription, Line: strings.TrimSpace(line)}
+		}
+	}
+	return &Failure{ModID: modID, Kind: FailureUnknown}
+}
+
+func itemFailureKind(reason string) FailureKind {
+	switch {
+	case strings.EqualFold(reason, "Timeout"):
+		return FailureTimeout
+	case strings.EqualFold(reason, "Failure"):
+		return FailureGeneric
+	case strings.EqualFold(reason, "No Connection"):
+		return FailureNoConnection
+	case noSubscriptionPattern.MatchString(reason):
+		return FailureNoSubscription
+	case diskWritePattern.MatchString(reason):
+		return FailureDiskWrite
+	case rateLimitPattern.MatchString(reason):
+		return FailureRateLimited
+	}
+	return FailureUnknown
+}
+
+// recordFailure records the final failure of a mod's download on the
+// servers using the mod.
+func (r *CommandRunner) recordFailure(st *state.State, f *Failure, now time.Time) {
+	st.Steam.LastFailureKind = string(f.Kind)
+	st.Steam.LastFailureAt = &now
+	RecordModError(st, f.ModID, "steamcmd_download", "download mod", f)
+}
@@ -0,0 +1,150 @@
+package steamcmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+)
+
+// populateStaging fills stagingDir with the content of source:
+//   - copy copies every file.
+//   - hardlink links every file to SteamCMD's copy, falling back to a copy
+//     when linking fails (e.g. across filesystems). Before the next download
+//     detachHardlinks gives the local files their own inodes again, so an
+//     in-place patch by SteamCMD cannot reach local_mods_root.
+//   - delta links files whose size and mtime match the current local version
+//     in target and copies the rest from source, so the previous version is
+//     never modified and SteamCMD's copy is never shared.
+func populateStaging(strategy, source, stagingDir, target string) error {
+	switch strategy {
+	case "", config.MirrorStrategyCopy:
+		return walkFiles(source, stagingDir, func(src, dst, _ string, info os.FileInfo) error {
+			return copyFile(src, dst, info)
+		})
+	case config.MirrorStrategyHardlink:
+		return walkFiles(source, stagingDir, func(src, dst, _ string, info os.FileInfo) error {
+			return linkOrCopy(src, src, dst, info)
+		})
+	case config.MirrorStrategyDelta:
+		return walkFiles(source, stagingDir, func(src, dst, rel string, info os.FileInfo) error {
+			prev := filepath.Join(target, rel)
+			if unchanged(prev, info) {
+				return linkOrCopy(prev, src, dst, info)
+			}
+			return copyFile(src, dst, info)
+		})
+	default:
+		return fmt.Errorf("unknown mirror strategy %q", strategy)
+	}
+}
+
+// stagingCopyBytes estimates how many bytes populateStaging writes.
+func stagingCopyBytes(strategy, source, target string) (int64, error) {
+	var total int64
+	err := filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		switch strategy {
+		case config.MirrorStrategyHardlink:
+			return nil
+		case config.MirrorStrategyDelta:
+			rel, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			if unchanged(filepath.Join(target, rel), info) {
+				return nil
+			}
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+func walkFiles(src, dst string, fn func(srcPath, dstPath, rel string, info os.FileInfo) error) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("source is not directory: %s", src)
+	}
+	return filepath.Walk(src, func(p string, d os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, d.Mode())
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return fn(p, target, rel, d)
+	})
+}
+
+// detachHardlinks replaces every file in target that shares its inode with the
+// same file in source by a private copy. It returns how many files it copied.
+func detachHardlinks(source, target string) (int, error) {
+	detached := 0
+	err := filepath.Walk(target, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == target {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(target, p)
+		if err != nil {
+			return err
+		}
+		srcInfo, err := os.Lstat(filepath.Join(source, rel))
+		if err != nil || !os.SameFile(info, srcInfo) {
+			return nil
+		}
+		tmp := p + ".detach"
+		if err := copyFile(p, tmp, info); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, p); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		detached++
+		return nil
+	})
+	return detached, err
+}
+
+// linkOrCopy hardlinks linkSrc to dst and copies copySrc instead if linking
+// is not possible.
+func linkOrCopy(linkSrc, copySrc, dst string, info os.FileInfo) error {
+	if err := os.Link(linkSrc, dst); err == nil {
+		return nil
+	}
+	return copyFile(copySrc, dst, info)
+}
+
+func unchanged(prev string, info os.FileInfo) bool {
+	prevInfo, err := os.Lstat(prev)
+	if err != nil {
+		return false
+	}
+	return prevInfo.Mode().IsRegular() && prevInfo.Size() == info.Size() && prevInfo.ModTime().Equal(info.ModTime())
+}
@@ -0,0 +1,166 @@
+package steamcmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	progressWriteEvery = time.Second
+	progressLogEvery   = 5 * time.Second
+	progressLogStep    = 10.0
+)
+
+type consumeResult struct {
+	output   string
+	writeErr error
+}
+
+// consumeOutput reads SteamCMD output until EOF. It keeps draining after a
+// log write error so the process never blocks on a full pipe.
+func consumeOutput(r io.Reader, log io.Writer, password string, tracker *progressTracker) consumeResult {
+	var res consumeResult
+	var output strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		line := RedactPassword(scanner.Text(), password)
+		output.WriteString(line)
+		output.WriteByte('\n')
+		if res.writeErr == nil {
+			if _, err := io.WriteString(log, line+"\n"); err != nil {
+				res.writeErr = err
+			}
+		}
+		tracker.line(line)
+	}
+	if err := scanner.Err(); err != nil {
+		// Drain so SteamCMD can exit.
+		_, _ = io.Copy(io.Discard, r)
+		if res.writeErr == nil {
+			res.writeErr = err
+		}
+	}
+	res.output = output.String()
+	return res
+}
+
+// scanLines splits on \n, \r\n and bare \r, which SteamCMD uses to redraw
+// progress lines.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		if data[i] == '\r' && i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// progressTracker turns progress lines into throttled snapshot writes and
+// log events.
+type progressTracker struct {
+	localCacheRoot string
+	logger         *slog.Logger
+	progress       Progress
+	lastWrite      time.Time
+	lastLog        time.Time
+	lastLogPercent float64
+}
+
+func newProgressTracker(localCacheRoot string, logger *slog.Logger, initial Progress) *progressTracker {
+	t := &progressTracker{localCacheRoot: localCacheRoot, logger: logger, progress: initial, lastLogPercent: -progressLogStep}
+	t.write(true)
+	return t
+}
+
+func (t *progressTracker) line(line string) {
+	if strings.TrimSpace(line) != "" {
+		t.progress.LastLine = line
+	}
+	percent, done, total, ok := ParseProgress(line)
+	if !ok {
+		return
+	}
+	t.progress.Percent = percent
+	t.progress.BytesDone = done
+	t.progress.BytesTotal = total
+	now := time.Now().UTC()
+	t.progress.UpdatedAt = now
+	if percent-t.lastLogPercent >= progressLogStep || now.Sub(t.lastLog) >= progressLogEvery {
+		t.lastLog = now
+		t.lastLogPercent = percent
+		t.logger.Info("steamcmd progress", "mod_id", t.progress.ModID, "stage", "steamcmd_download", "attempt", t.progress.Attempt, "percent", percent, "bytes_done", done, "bytes_total", total)
+	}
+	t.write(false)
+}
+
+func (t *progressTracker) finish(state string) {
+	t.progress.State = state
+	t.progress.UpdatedAt = time.Now().UTC()
+	if state == ProgressSucceeded {
+		t.progress.Percent = 100
+	}
+	t.write(true)
+}
+
+func (t *progressTracker) write(force bool) {
+	if !force && time.Since(t.lastWrite) < progressWriteEvery {
+		return
+	}
+	t.lastWrite = time.Now()
+	if err := writeProgress(t.localCacheRoot, t.progress); err != nil {
+		t.logger.Error("steamcmd progress write failed", "mod_id", t.progress.ModID, "stage", "steamcmd_download", "error", err)
+	}
+}
+
+func modLogDir(localCacheRoot string) string {
+	return filepath.Join(localCacheRoot, "logs", "steamcmd")
+}
+
+// createModLog opens logs/steamcmd/<id>-<timestamp>.log for one SteamCMD run.
+func createModLog(localCacheRoot, modID string, at time.Time) (*os.File, string, error) {
+	dir := modLogDir(localCacheRoot)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, "", fmt.Errorf("ensure steamcmd log dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.log", modID, at.Format("20060102T150405.000Z")))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("create steamcmd log: %w", err)
+	}
+	return f, path, nil
+}
+
+// pruneModLogs keeps the newest keep logs of a mod.
+func pruneModLogs(localCacheRoot, modID string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(modLogDir(localCacheRoot), modID+"-*.log"))
+	if err != nil || len(matches) <= keep {
+		return
+	}
+	sort.Strings(matches)
+	for _, p := range matches[:len(matches)-keep] {
+		_ = os.Remove(p)
+	}
+}
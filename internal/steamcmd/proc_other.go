@@ -0,0 +1,10 @@
+//go:build !unix
+
+package steamcmd
+
+import "os/exec"
+
+// startInProcessGroup keeps exec's default of killing only the direct child.
+func startInProcessGroup(cmd *exec.Cmd) {
+	_ = cmd
+}
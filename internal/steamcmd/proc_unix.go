@@ -0,0 +1,17 @@
+//go:build unix
+
+package steamcmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startInProcessGroup puts SteamCMD (a shell wrapper around steamcmd_linux)
+// into its own process group so a kill reaches the whole tree.
+func startInProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,92 @@
+package steamcmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	// "Update state (0x61) downloading, progress: 45.23 (1234567 / 2729000)"
+	progressDetailPattern = regexp.MustCompile(`progress:\s*([0-9]+(?:\.[0-9]+)?)\s*\(([0-9]+)\s*/\s*([0-9]+)\)`)
+	// "[ 45%] Downloading update (1,234 of 2,729 KB)..."
+	progressPercentPattern = regexp.MustCompile(`\[\s*([0-9]{1,3})%\]`)
+)
+
+// Progress states.
+const (
+	ProgressRunning   = "running"
+	ProgressSucceeded = "succeeded"
+	ProgressFailed    = "failed"
+)
+
+// Progress is the live state of the SteamCMD run in progress (or the last
+// one), written to <local_cache_root>/status/steamcmd.json.
+type Progress struct {
+	ModID      string    `json:"mod_id"`
+	Account    string    `json:"account,omitempty"`
+	State      string    `json:"state"`
+	Attempt    int       `json:"attempt"`
+	Percent    float64   `json:"percent"`
+	BytesDone  int64     `json:"bytes_done,omitempty"`
+	BytesTotal int64     `json:"bytes_total,omitempty"`
+	LastLine   string    `json:"last_line,omitempty"`
+	LogPath    string    `json:"log_path"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ParseProgress extracts download progress from one SteamCMD output line.
+func ParseProgress(line string) (percent float64, done, total int64, ok bool) {
+	if m := progressDetailPattern.FindStringSubmatch(line); m != nil {
+		percent, _ = strconv.ParseFloat(m[1], 64)
+		done, _ = strconv.ParseInt(m[2], 10, 64)
+		total, _ = strconv.ParseInt(m[3], 10, 64)
+		return percent, done, total, true
+	}
+	if m := progressPercentPattern.FindStringSubmatch(line); m != nil {
+		percent, _ = strconv.ParseFloat(m[1], 64)
+		return percent, 0, 0, true
+	}
+	return 0, 0, 0, false
+}
+
+func progressPath(localCacheRoot string) string {
+	return filepath.Join(localCacheRoot, "status", "steamcmd.json")
+}
+
+// ReadProgress returns the last progress snapshot, or nil if SteamCMD has not
+// run yet.
+func ReadProgress(localCacheRoot string) (*Progress, error) {
+	b, err := os.ReadFile(progressPath(localCacheRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var p Progress
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func writeProgress(localCacheRoot string, p Progress) error {
+	path := progressPath(localCacheRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
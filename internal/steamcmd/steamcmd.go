@@ -1,11 +1,12 @@
 package steamcmd
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,6 +15,8 @@ import (
 	"time"
 
 	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
+	"github.com/example/dayz-standalone-mode-updater/internal/pbo"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
 )
 
@@ -26,28 +29,59 @@ type Runner interface {
 }
 
 type CommandRunner struct {
-	cfg config.Config
+	cfg        config.Config
+	logger     *slog.Logger
+	httpClient *http.Client
+	// nextAccount rotates the account pool for round_robin.
+	nextAccount int
 }
 
 func NewRunner(cfg config.Config) *CommandRunner {
-	return &CommandRunner{cfg: cfg}
+	return &CommandRunner{cfg: cfg, logger: slog.Default(), httpClient: &http.Client{Timeout: 10 * time.Minute}}
+}
+
+func (r *CommandRunner) WithLogger(logger *slog.Logger) *CommandRunner {
+	if logger != nil {
+		r.logger = logger
+	}
+	return r
 }
 
 func (r *CommandRunner) UpdateMods(ctx context.Context, modIDs []string, st *state.State) ([]string, error) {
 	if len(modIDs) == 0 {
 		return nil, nil
 	}
+	if err := r.ensureInstalled(ctx); err != nil {
+		return nil, err
+	}
 	succeeded := make([]string, 0, len(modIDs))
 	for _, id := range modIDs {
-		output, err := r.runSteamCMDWithRetry(ctx, id)
-		if err != nil {
+		if err := r.preflightDisk(st.Mods[id]); err != nil {
+			RecordModError(st, id, "preflight_disk", "check local disk space", err)
+			return succeeded, fmt.Errorf("preflight mod %s: %w", id, err)
+		}
+		if err := r.detachLocalMod(id, st.Mods[id].FolderSlug); err != nil {
+			RecordModError(st, id, "mirror", "detach hardlinked mod files", err)
+			return succeeded, fmt.Errorf("detach mod %s: %w", id, err)
+		}
+		if err := r.downloadMod(ctx, id, st); err != nil {
+			var failure *Failure
+			if errors.As(err, &failure) {
+				r.recordFailure(st, failure, time.Now().UTC())
+			}
 			return succeeded, err
 		}
-		results := ParseSuccessByModID(output)
-		if !results[id] || !r.hasDownloadedContent(id) {
-			continue
+		if !r.hasDownloadedContent(id) {
+			failure := &Failure{ModID: id, Kind: FailureUnknown, Err: errors.New("reported success but workshop content dir is missing")}
+			r.recordFailure(st, failure, time.Now().UTC())
+			return succeeded, failure
 		}
 		modState := st.Mods[id]
+		// The staging copy is validated before the swap, so a broken
+		// download keeps the previous local version in place.
+		// local_updated_at stays behind so the mod is downloaded (with
+		// validate) again on the next workshop poll.
+		var validationErr error
 		if err := MirrorWorkshopContent(
 			r.cfg.Paths.SteamcmdWorkshopContentRoot,
 			fmt.Sprintf("%d", r.cfg.Steam.WorkshopGameID),
@@ -55,9 +89,24 @@ func (r *CommandRunner) UpdateMods(ctx context.Context, modIDs []string, st *sta
 			r.cfg.Paths.LocalModsRoot,
 			modState.FolderSlug,
 			r.cfg.Paths.LocalCacheRoot,
+			r.cfg.Steam.MirrorStrategy,
+			func(dir string) error {
+				validationErr = r.validateMod(id, dir)
+				return validationErr
+			},
 		); err != nil {
+			if validationErr != nil {
+				modState.ValidationError = validationErr.Error()
+				st.Mods[id] = modState
+				RecordModError(st, id, "validate_content", "validate mod content", validationErr)
+				return succeeded, fmt.Errorf("validate mod %s: %w", id, validationErr)
+			}
+			if diskspace.IsInsufficient(err) {
+				RecordModError(st, id, "preflight_disk", "check staging disk space", err)
+			}
 			return succeeded, fmt.Errorf("mirror workshop mod %s: %w", id, err)
 		}
+		modState.ValidationError = ""
 
 		if modState.WorkshopUpdatedAt.IsZero() {
 			modState.LocalUpdatedAt = time.Now().UTC()
@@ -71,46 +120,176 @@ func (r *CommandRunner) UpdateMods(ctx context.Context, modIDs []string, st *sta
 	return succeeded, nil
 }
 
-func (r *CommandRunner) runSteamCMDWithRetry(ctx context.Context, modID string) (string, error) {
-	var lastErr error
-	for attempt := 1; attempt <= r.cfg.Steam.SteamCMDRetriesPerMod; attempt++ {
-		output, err := r.runSteamCMD(ctx, []string{modID})
-		if err == nil {
-			return output, nil
+// preflightDisk requires twice the Workshop file size on the SteamCMD content
+// root and on the staging area: once for the download, once for the staging
+// copy. Mods without a known size are not checked.
+func (r *CommandRunner) preflightDisk(mod state.ModState) error {
+	if mod.FileSize <= 0 {
+		return nil
+	}
+	required := uint64(mod.FileSize) * 2
+	for _, p := range []string{r.cfg.Paths.SteamcmdWorkshopContentRoot, filepath.Join(r.cfg.Paths.LocalCacheRoot, "staging")} {
+		if err := diskspace.Check(p, required); err != nil {
+			return err
 		}
-		lastErr = err
-		if attempt == r.cfg.Steam.SteamCMDRetriesPerMod || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+	}
+	return nil
+}
+
+// detachLocalMod breaks the inodes the hardlink strategy shares between the
+// local mod folder and SteamCMD's copy before SteamCMD touches the latter.
+func (r *CommandRunner) detachLocalMod(id, folderSlug string) error {
+	if r.cfg.Steam.MirrorStrategy != config.MirrorStrategyHardlink {
+		return nil
+	}
+	if strings.TrimSpace(folderSlug) == "" {
+		folderSlug = "mod-" + id
+	}
+	source := filepath.Join(r.cfg.Paths.SteamcmdWorkshopContentRoot, fmt.Sprintf("%d", r.cfg.Steam.WorkshopGameID), id)
+	detached, err := detachHardlinks(source, filepath.Join(r.cfg.Paths.LocalModsRoot, folderSlug))
+	if detached > 0 {
+		r.logger.Info("steamcmd detached hardlinked mod files", "mod_id", id, "files", detached)
+	}
+	return err
+}
+
+func (r *CommandRunner) validateMod(id, dir string) error {
+	return pbo.ValidateMod(dir, pbo.ValidateOptions{
+		AllowUnsigned: contains(r.cfg.Steam.UnsignedMods, id),
+	})
+}
+
+// runSteamCMDWithRetry runs SteamCMD until it reports success for modID. A
+// failed run is classified with ParseFailure and retried according to the
+// retry policy of its kind; the last failure is returned.
+func (r *CommandRunner) runSteamCMDWithRetry(ctx context.Context, modID string, acct account, st *state.State) error {
+	var failure *Failure
+	attempt := 1
+	for ; attempt <= r.cfg.Steam.SteamCMDRetriesPerMod; attempt++ {
+		output, err := r.runSteamCMD(ctx, modID, attempt, acct)
+		if ctx.Err() != nil {
+			return fmt.Errorf("steamcmd mod %s: %w", modID, ctx.Err())
+		}
+		if err == nil && ParseSuccessByModID(output)[modID] {
+			return nil
+		}
+		failure = ParseFailure(output, modID)
+		failure.Err = err
+		var hang *HangError
+		if errors.As(err, &hang) {
+			failure.Kind = FailureHung
+			now := time.Now().UTC()
+			st.Steam.HangCount++
+			st.Steam.LastHangAt = &now
+			r.logger.Warn("steamcmd killed by watchdog", "mod_id", modID, "attempt", attempt, "reason", hang.Reason, "hang_count", st.Steam.HangCount)
+		}
+		policy := retryPolicies[failure.Kind]
+		if !policy.retry || attempt == r.cfg.Steam.SteamCMDRetriesPerMod {
 			break
 		}
+		r.logger.Warn("steamcmd attempt failed", "mod_id", modID, "account", acct.login, "attempt", attempt, "failure_kind", string(failure.Kind))
 		select {
 		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(time.Duration(r.cfg.Steam.SteamCMDBackoffMillis*attempt) * time.Millisecond):
+			return fmt.Errorf("steamcmd mod %s: %w", modID, ctx.Err())
+		case <-time.After(time.Duration(r.cfg.Steam.SteamCMDBackoffMillis*attempt*policy.backoffFactor) * time.Millisecond):
 		}
 	}
-	return "", fmt.Errorf("steamcmd mod %s failed after retries: %w", modID, lastErr)
+	return fmt.Errorf("steamcmd mod %s failed after %d attempt(s): %w", modID, attempt, failure)
 }
 
-func (r *CommandRunner) runSteamCMD(ctx context.Context, modIDs []string) (string, error) {
-	args := []string{"+login", r.cfg.Steam.Login, r.cfg.Steam.Password}
-	for _, id := range modIDs {
-		args = append(args, "+workshop_download_item", fmt.Sprintf("%d", r.cfg.Steam.WorkshopGameID), id, "validate")
+// runSteamCMD streams SteamCMD's output line by line into a per-mod log
+// file, the progress snapshot and structured progress events, and returns
+// the redacted output for success detection.
+func (r *CommandRunner) runSteamCMD(ctx context.Context, modID string, attempt int, acct account) (string, error) {
+	var args []string
+	if acct.home != "" {
+		// A separate HOME would otherwise move the workshop content too.
+		args = append(args, "+force_install_dir", config.WorkshopInstallDir(r.cfg.Paths.SteamcmdWorkshopContentRoot))
+		if err := os.MkdirAll(acct.home, 0o700); err != nil {
+			return "", fmt.Errorf("ensure steam account home: %w", err)
+		}
+	}
+	args = append(args, "+login", acct.login)
+	if !acct.anonymous() {
+		args = append(args, acct.password)
+	}
+	args = append(args,
+		"+workshop_download_item", fmt.Sprintf("%d", r.cfg.Steam.WorkshopGameID), modID, "validate",
+		"+quit",
+	)
+	start := time.Now().UTC()
+	logFile, logPath, err := createModLog(r.cfg.Paths.LocalCacheRoot, modID, start)
+	if err != nil {
+		return "", err
+	}
+	defer pruneModLogs(r.cfg.Paths.LocalCacheRoot, modID, r.cfg.Steam.SteamCMDLogsPerMod)
+
+	tracker := newProgressTracker(r.cfg.Paths.LocalCacheRoot, r.logger, Progress{
+		ModID:     modID,
+		Account:   acct.login,
+		State:     ProgressRunning,
+		Attempt:   attempt,
+		LogPath:   logPath,
+		StartedAt: start,
+		UpdatedAt: start,
+	})
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if r.cfg.Steam.SteamCMDTimeoutSeconds > 0 {
+		timeout := time.Duration(r.cfg.Steam.SteamCMDTimeoutSeconds) * time.Second
+		var stop context.CancelFunc
+		runCtx, stop = context.WithTimeoutCause(runCtx, timeout, &HangError{Reason: fmt.Sprintf("still running after %s", timeout)})
+		defer stop()
 	}
-	args = append(args, "+quit")
 
-	cmd := exec.CommandContext(ctx, r.cfg.Paths.SteamcmdPath, args...)
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
-	err := cmd.Run()
-	sanitized := RedactPassword(output.String(), r.cfg.Steam.Password)
-	if writeErr := writeSteamCMDLog(r.cfg.Paths.LocalCacheRoot, sanitized); writeErr != nil {
-		return sanitized, writeErr
+	pr, pw := io.Pipe()
+	activity := newActivityReader(pr)
+	cmd := exec.CommandContext(runCtx, r.cfg.Paths.SteamcmdPath, args...)
+	startInProcessGroup(cmd)
+	if acct.home != "" {
+		cmd.Env = append(os.Environ(), "HOME="+acct.home)
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	// Stop waiting for output from children that survived the kill.
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		logFile.Close()
+		tracker.finish(ProgressFailed)
+		return "", fmt.Errorf("run steamcmd: %w", err)
+	}
+
+	if r.cfg.Steam.SteamCMDIdleTimeoutSeconds > 0 {
+		dl := downloadDir(r.cfg.Paths.SteamcmdWorkshopContentRoot, fmt.Sprintf("%d", r.cfg.Steam.WorkshopGameID), modID)
+		go watchIdle(runCtx, cancel, activity, dl, time.Duration(r.cfg.Steam.SteamCMDIdleTimeoutSeconds)*time.Second)
+	}
+	consumed := make(chan consumeResult, 1)
+	go func() {
+		consumed <- consumeOutput(activity, logFile, acct.password, tracker)
+	}()
+	err = cmd.Wait()
+	pw.Close()
+	result := <-consumed
+	closeErr := logFile.Close()
+
+	var hang *HangError
+	if cause := context.Cause(runCtx); ctx.Err() == nil && errors.As(cause, &hang) {
+		tracker.finish(ProgressFailed)
+		return result.output, hang
 	}
 	if err != nil {
-		return sanitized, fmt.Errorf("run steamcmd: %w", err)
+		tracker.finish(ProgressFailed)
+		return result.output, fmt.Errorf("run steamcmd: %w", err)
+	}
+	tracker.finish(ProgressSucceeded)
+	if result.writeErr != nil {
+		return result.output, fmt.Errorf("write steamcmd log: %w", result.writeErr)
+	}
+	if closeErr != nil {
+		return result.output, fmt.Errorf("write steamcmd log: %w", closeErr)
 	}
-	return sanitized, nil
+	return result.output, nil
 }
 
 func ParseSuccessByModID(logOutput string) map[string]bool {
@@ -129,17 +308,6 @@ func RedactPassword(logOutput, password string) string {
 	return strings.ReplaceAll(logOutput, password, "[REDACTED]")
 }
 
-func writeSteamCMDLog(localCacheRoot, content string) error {
-	path := filepath.Join(localCacheRoot, "logs", "steamcmd.log")
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return fmt.Errorf("ensure steamcmd log dir: %w", err)
-	}
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-		return fmt.Errorf("write steamcmd log: %w", err)
-	}
-	return nil
-}
-
 func (r *CommandRunner) hasDownloadedContent(modID string) bool {
 	path := filepath.Join(
 		r.cfg.Paths.SteamcmdWorkshopContentRoot,
@@ -150,7 +318,11 @@ func (r *CommandRunner) hasDownloadedContent(modID string) bool {
 	return err == nil && info.IsDir()
 }
 
-func MirrorWorkshopContent(steamcmdContentRoot, appID, workshopID, localModsRoot, folderSlug, localCacheRoot string) error {
+// MirrorWorkshopContent builds the new mod folder in a staging directory
+// using strategy (see populateStaging) and swaps it into place once validate
+// (if set) accepts the staging directory. A rejected download leaves the
+// previous folder untouched.
+func MirrorWorkshopContent(steamcmdContentRoot, appID, workshopID, localModsRoot, folderSlug, localCacheRoot, strategy string, validate func(dir string) error) error {
 	if strings.TrimSpace(folderSlug) == "" {
 		folderSlug = "mod-" + workshopID
 	}
@@ -160,14 +332,26 @@ func MirrorWorkshopContent(steamcmdContentRoot, appID, workshopID, localModsRoot
 	if err := os.MkdirAll(stagingRoot, 0o755); err != nil {
 		return fmt.Errorf("ensure staging root: %w", err)
 	}
+	size, err := stagingCopyBytes(strategy, source, target)
+	if err != nil {
+		return fmt.Errorf("measure workshop dir: %w", err)
+	}
+	if err := diskspace.Check(stagingRoot, uint64(size)); err != nil {
+		return err
+	}
 	stagingDir, err := os.MkdirTemp(stagingRoot, folderSlug+"-")
 	if err != nil {
 		return fmt.Errorf("create staging dir: %w", err)
 	}
 	defer os.RemoveAll(stagingDir)
 
-	if err := copyDir(source, stagingDir); err != nil {
-		return fmt.Errorf("copy workshop dir: %w", err)
+	if err := populateStaging(strategy, source, stagingDir, target); err != nil {
+		return fmt.Errorf("%s workshop dir: %w", strategy, err)
+	}
+	if validate != nil {
+		if err := validate(stagingDir); err != nil {
+			return fmt.Errorf("validate staging dir: %w", err)
+		}
 	}
 	if err := os.MkdirAll(localModsRoot, 0o755); err != nil {
 		return fmt.Errorf("ensure local mods root: %w", err)
@@ -187,40 +371,16 @@ func MirrorWorkshopContent(steamcmdContentRoot, appID, workshopID, localModsRoot
 	return nil
 }
 
-func copyDir(src, dst string) error {
-	info, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("source is not directory: %s", src)
-	}
-	return filepath.Walk(src, func(path string, d os.FileInfo, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		rel, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
-		}
-		target := filepath.Join(dst, rel)
-		if d.IsDir() {
-			return os.MkdirAll(target, d.Mode())
-		}
-		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-			return err
-		}
-		return copyFile(path, target, d.Mode())
-	})
-}
-
-func copyFile(src, dst string, mode os.FileMode) error {
+// copyFile copies src to dst, keeping its mode and mtime. Copies keep the
+// source mtime so the size/mtime diffs (delta mirroring, SFTP sync) see
+// unchanged files as equal.
+func copyFile(src, dst string, info os.FileInfo) error {
 	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
 	if err != nil {
 		return err
 	}
@@ -228,7 +388,10 @@ func copyFile(src, dst string, mode os.FileMode) error {
 	if _, err := io.Copy(out, in); err != nil {
 		return err
 	}
-	return out.Close()
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
 }
 
 func MarkServersUsingModForPlanning(st *state.State, modID string) {
@@ -241,6 +404,20 @@ func MarkServersUsingModForPlanning(st *state.State, modID string) {
 	}
 }
 
+// RecordModError records err on every server whose modlist contains modID
+// without touching its stage, so the failure is visible in state.json.
+func RecordModError(st *state.State, modID, stage, step string, err error) {
+	now := time.Now().UTC()
+	for serverID, srv := range st.Servers {
+		if contains(srv.LastModIDs, modID) {
+			srv.LastError = fmt.Sprintf("mod %s step %s: %v", modID, step, err)
+			srv.LastErrorStage = stage
+			srv.LastErrorAt = &now
+			st.Servers[serverID] = srv
+		}
+	}
+}
+
 func contains(ids []string, modID string) bool {
 	for _, id := range ids {
 		if id == modID {
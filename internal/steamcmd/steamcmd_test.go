@@ -1,10 +1,28 @@
 package steamcmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/diskspace"
 	"github.com/example/dayz-standalone-mode-updater/internal/state"
 )
 
@@ -57,7 +75,7 @@ func TestMirrorWorkshopContentAtomicSwap(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := MirrorWorkshopContent(steamRoot, appID, workshopID, localMods, slug, cacheRoot); err != nil {
+	if err := MirrorWorkshopContent(steamRoot, appID, workshopID, localMods, slug, cacheRoot, config.MirrorStrategyCopy, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -95,3 +113,721 @@ func TestMarkServersUsingModForPlanning(t *testing.T) {
 		t.Fatalf("expected server s2 unchanged, got %#v", st.Servers["s2"])
 	}
 }
+
+func TestUpdateModsFailsDiskPreflightBeforeRunningSteamCMD(t *testing.T) {
+	root := t.TempDir()
+	if _, err := diskspace.Free(root); err == diskspace.ErrUnsupported {
+		t.Skip("free space query not supported")
+	}
+	cfg := config.Config{
+		Paths: config.PathsConfig{
+			LocalModsRoot:               filepath.Join(root, "mods"),
+			LocalCacheRoot:              filepath.Join(root, "cache"),
+			SteamcmdPath:                filepath.Join(root, "steamcmd-must-not-run"),
+			SteamcmdWorkshopContentRoot: filepath.Join(root, "content"),
+		},
+		Steam: config.SteamConfig{Login: "bob", Password: "pw", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 1},
+	}
+	st := state.State{
+		Mods: map[string]state.ModState{"1": {FolderSlug: "big", FileSize: 1 << 61}},
+		Servers: map[string]state.ServerState{
+			"s1": {LastModIDs: []string{"1"}, Stage: state.StageIdle},
+			"s2": {LastModIDs: []string{"2"}, Stage: state.StageIdle},
+		},
+	}
+
+	_, err := NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st)
+	if !diskspace.IsInsufficient(err) {
+		t.Fatalf("expected insufficient space error, got %v", err)
+	}
+	if got := st.Servers["s1"]; got.LastErrorStage != "preflight_disk" || got.Stage != state.StageIdle {
+		t.Fatalf("expected preflight_disk error without stage change, got %#v", got)
+	}
+	if st.Servers["s2"].LastErrorStage != "" {
+		t.Fatal("server without the mod must not get the error")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Paths.LocalCacheRoot, "logs", "steamcmd")); !os.IsNotExist(err) {
+		t.Fatalf("steamcmd should not have run, log stat err = %v", err)
+	}
+}
+
+func TestMirrorWorkshopContentStrategies(t *testing.T) {
+	root := t.TempDir()
+	steamRoot := filepath.Join(root, "steam", "content")
+	localMods := filepath.Join(root, "mods")
+	cacheRoot := filepath.Join(root, "cache")
+	src := filepath.Join(steamRoot, "221100", "1")
+	target := filepath.Join(localMods, "cf")
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	write := func(rel, content string, at time.Time) {
+		t.Helper()
+		p := filepath.Join(src, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat := func(p string) os.FileInfo {
+		t.Helper()
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	write("addons/a.pbo", "payload", mtime)
+	write("meta.cpp", "v1", mtime)
+
+	if err := MirrorWorkshopContent(steamRoot, "221100", "1", localMods, "cf", cacheRoot, config.MirrorStrategyCopy, nil); err != nil {
+		t.Fatal(err)
+	}
+	copied := stat(filepath.Join(target, "addons", "a.pbo"))
+	if !copied.ModTime().Equal(mtime) {
+		t.Fatalf("copy did not keep mtime: %v", copied.ModTime())
+	}
+	if os.SameFile(copied, stat(filepath.Join(src, "addons", "a.pbo"))) {
+		t.Fatal("copy must not share files with steamcmd content")
+	}
+
+	write("meta.cpp", "v2", mtime.Add(time.Hour))
+	write("addons/b.pbo", "new", mtime)
+	if err := MirrorWorkshopContent(steamRoot, "221100", "1", localMods, "cf", cacheRoot, config.MirrorStrategyDelta, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(copied, stat(filepath.Join(target, "addons", "a.pbo"))) {
+		t.Fatal("delta should link unchanged files from the previous version")
+	}
+	if os.SameFile(stat(filepath.Join(target, "meta.cpp")), stat(filepath.Join(src, "meta.cpp"))) {
+		t.Fatal("delta must copy changed files, not link steamcmd content")
+	}
+	if b, _ := os.ReadFile(filepath.Join(target, "meta.cpp")); string(b) != "v2" {
+		t.Fatalf("unexpected changed file content: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(target, "addons", "b.pbo")); err != nil {
+		t.Fatalf("expected new file, got %v", err)
+	}
+
+	if err := MirrorWorkshopContent(steamRoot, "221100", "1", localMods, "cf", cacheRoot, config.MirrorStrategyHardlink, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(stat(filepath.Join(target, "meta.cpp")), stat(filepath.Join(src, "meta.cpp"))) {
+		t.Fatal("hardlink should share files with steamcmd content")
+	}
+	detached, err := detachHardlinks(src, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detached != 3 {
+		t.Fatalf("expected 3 detached files, got %d", detached)
+	}
+	write("meta.cpp", "v3", mtime.Add(2*time.Hour))
+	if b, _ := os.ReadFile(filepath.Join(target, "meta.cpp")); string(b) != "v2" {
+		t.Fatalf("in-place steamcmd write reached the local copy: %q", b)
+	}
+	if got := stat(filepath.Join(target, "addons", "a.pbo")).ModTime(); !got.Equal(mtime) {
+		t.Fatalf("detach did not keep mtime: %v", got)
+	}
+	entries, err := os.ReadDir(filepath.Join(cacheRoot, "staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected empty staging dir, got %d entries", len(entries))
+	}
+}
+
+func TestUpdateModsRecordsValidationFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	root := t.TempDir()
+	script := filepath.Join(root, "steamcmd.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho 'Success. Downloaded item 1 to \"x\"'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := filepath.Join(root, "content", "221100", "1", "addons")
+	if err := os.MkdirAll(content, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(content, "cf.pbo"), []byte("trunc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := filepath.Join(root, "mods", "cf", "addons", "cf.pbo")
+	if err := os.MkdirAll(filepath.Dir(previous), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previous, []byte("previous version"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{
+		Paths: config.PathsConfig{
+			LocalModsRoot:               filepath.Join(root, "mods"),
+			LocalCacheRoot:              filepath.Join(root, "cache"),
+			SteamcmdPath:                script,
+			SteamcmdWorkshopContentRoot: filepath.Join(root, "content"),
+		},
+		Steam: config.SteamConfig{Login: "bob", Password: "pw", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 1, UnsignedMods: []string{"1"}},
+	}
+	updatedAt := time.Unix(1700000000, 0).UTC()
+	st := state.State{
+		Mods:    map[string]state.ModState{"1": {FolderSlug: "cf", WorkshopUpdatedAt: updatedAt}},
+		Servers: map[string]state.ServerState{"s1": {LastModIDs: []string{"1"}, Stage: state.StageIdle}},
+	}
+
+	_, err := NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	mod := st.Mods["1"]
+	if !strings.Contains(mod.ValidationError, "addons/cf.pbo: unreadable header") || !mod.LocalUpdatedAt.IsZero() {
+		t.Fatalf("unexpected mod state: %#v", mod)
+	}
+	if got := st.Servers["s1"]; got.LastErrorStage != "validate_content" || got.NeedsModUpdate {
+		t.Fatalf("unexpected server state: %#v", got)
+	}
+	if b, err := os.ReadFile(previous); err != nil || string(b) != "previous version" {
+		t.Fatalf("expected the previous local version to be kept, got %q, %v", b, err)
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	pct, done, total, ok := ParseProgress(" Update state (0x61) downloading, progress: 45.23 (1234567 / 2729000)")
+	if !ok || pct != 45.23 || done != 1234567 || total != 2729000 {
+		t.Fatalf("unexpected detailed progress: %v %d %d %v", pct, done, total, ok)
+	}
+	pct, _, _, ok = ParseProgress("[ 7%] Downloading update (1,234 of 2,729 KB)...")
+	if !ok || pct != 7 {
+		t.Fatalf("unexpected percent progress: %v %v", pct, ok)
+	}
+	if _, _, _, ok := ParseProgress("Loading Steam API...OK"); ok {
+		t.Fatal("expected no progress")
+	}
+}
+
+func TestConsumeOutputSplitsCarriageReturns(t *testing.T) {
+	root := t.TempDir()
+	var log strings.Builder
+	tracker := newProgressTracker(root, slog.New(slog.NewTextHandler(io.Discard, nil)), Progress{ModID: "1", State: ProgressRunning})
+	res := consumeOutput(strings.NewReader("login secret\r\nprogress: 10.00 (10 / 100)\rprogress: 50.00 (50 / 100)\rdone"), &log, "secret", tracker)
+	if res.writeErr != nil {
+		t.Fatal(res.writeErr)
+	}
+	want := "login [REDACTED]\nprogress: 10.00 (10 / 100)\nprogress: 50.00 (50 / 100)\ndone\n"
+	if res.output != want || log.String() != want {
+		t.Fatalf("unexpected output:\n%q\n%q", res.output, log.String())
+	}
+	if tracker.progress.Percent != 50 || tracker.progress.BytesDone != 50 || tracker.progress.LastLine != "done" {
+		t.Fatalf("unexpected progress: %#v", tracker.progress)
+	}
+}
+
+func TestRunSteamCMDWritesPerModLogsAndProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	root := t.TempDir()
+	script := filepath.Join(root, "steamcmd.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"args $*\"\nprintf 'progress: 50.00 (5 / 10)\\r'\necho 'Success. Downloaded item 1'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{
+		Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: script},
+		Steam: config.SteamConfig{Login: "user", Password: "hunter2", WorkshopGameID: 221100, SteamCMDLogsPerMod: 2},
+	}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for attempt := 1; attempt <= 3; attempt++ {
+		output, err := runner.runSteamCMD(context.Background(), "1", attempt, account{login: "user", password: "hunter2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ParseSuccessByModID(output)["1"] || strings.Contains(output, "hunter2") {
+			t.Fatalf("unexpected output: %q", output)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	logs, err := filepath.Glob(filepath.Join(root, "logs", "steamcmd", "1-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 rotated logs, got %v", logs)
+	}
+	b, err := os.ReadFile(logs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "hunter2") || !strings.Contains(string(b), "[REDACTED]") {
+		t.Fatalf("expected redacted log, got %q", b)
+	}
+	progress, err := ReadProgress(root)
+	if err != nil || progress == nil {
+		t.Fatalf("read progress: %v, %v", progress, err)
+	}
+	if progress.State != ProgressSucceeded || progress.Attempt != 3 || progress.Percent != 100 || progress.BytesTotal != 10 || progress.LogPath != logs[1] {
+		t.Fatalf("unexpected progress snapshot: %#v", progress)
+	}
+}
+
+func TestParseFailure(t *testing.T) {
+	failureLog, err := os.ReadFile(filepath.Join("testdata", "steamcmd_failure.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		output string
+		modID  string
+		want   FailureKind
+	}{
+		{"timeout", string(failureLog), "1559212036", FailureTimeout},
+		{"no subscription", string(failureLog), "2222222222", FailureNoSubscription},
+		{"generic", "ERROR! Download item 1 failed (Failure).", "1", FailureGeneric},
+		{"no connection", "ERROR! Download item 1 failed (No Connection).", "1", FailureNoConnection},
+		{"invalid password", "Logging in user 'bob' to Steam Public...FAILED login with result code Invalid Password\nERROR! Download item 1 failed (Failure).", "1", FailureInvalidPassword},
+		{"rate limit", "FAILED login with result code Rate Limit Exceeded", "1", FailureRateLimited},
+		{"disk write", "ERROR! Download item 1 failed (Disk Write Failure).", "1", FailureDiskWrite},
+		{"disk write line", "Error! Disk write failure while writing addons/cf.pbo", "1", FailureDiskWrite},
+		{"unknown", "Segmentation fault", "1", FailureUnknown},
+	}
+	for _, tc := range cases {
+		if got := ParseFailure(tc.output, tc.modID); got.Kind != tc.want {
+			t.Errorf("%s: kind = %s, want %s", tc.name, got.Kind, tc.want)
+		}
+	}
+}
+
+// fakeSteamCMD writes a script that appends one line per run to a counter
+// file and prints output.
+func fakeSteamCMD(t *testing.T, root, output string) (string, func() int) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	script := filepath.Join(root, "steamcmd.sh")
+	runs := filepath.Join(root, "runs")
+	body := "#!/bin/sh\necho run >> '" + runs + "'\nprintf '%s\\n' '" + output + "'\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, func() int {
+		b, _ := os.ReadFile(runs)
+		return strings.Count(string(b), "run")
+	}
+}
+
+func TestUpdateModsRetryPolicyByFailureKind(t *testing.T) {
+	cases := []struct {
+		output   string
+		wantRuns int
+	}{
+		{"ERROR! Download item 1 failed (Timeout).", 3},
+		{"ERROR! Download item 1 failed (No subscription).", 1},
+		{"ERROR! Download item 1 failed (Disk Write Failure).", 1},
+	}
+	for _, tc := range cases {
+		root := t.TempDir()
+		script, runs := fakeSteamCMD(t, root, tc.output)
+		cfg := config.Config{
+			Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: script, SteamcmdWorkshopContentRoot: filepath.Join(root, "content")},
+			Steam: config.SteamConfig{Login: "bob", Password: "pw", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 3, SteamCMDBackoffMillis: 1},
+		}
+		st := state.State{
+			Mods:    map[string]state.ModState{"1": {FolderSlug: "cf"}},
+			Servers: map[string]state.ServerState{"s1": {LastModIDs: []string{"1"}}},
+		}
+		_, err := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))).UpdateMods(context.Background(), []string{"1"}, &st)
+		if !ModFailed(err) || StopsBatch(err) {
+			t.Fatalf("%q: expected a mod-only failure, got %v", tc.output, err)
+		}
+		if got := runs(); got != tc.wantRuns {
+			t.Fatalf("%q: steamcmd ran %d times, want %d", tc.output, got, tc.wantRuns)
+		}
+		if got := st.Servers["s1"]; got.LastErrorStage != "steamcmd_download" || !strings.Contains(got.LastError, tc.output) {
+			t.Fatalf("%q: unexpected server state: %#v", tc.output, got)
+		}
+	}
+}
+
+func TestUpdateModsInvalidPasswordBlocksUntilCredentialsChange(t *testing.T) {
+	root := t.TempDir()
+	script, runs := fakeSteamCMD(t, root, "FAILED login with result code Invalid Password")
+	cfg := config.Config{
+		Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: script, SteamcmdWorkshopContentRoot: filepath.Join(root, "content")},
+		Steam: config.SteamConfig{Login: "bob", Password: "wrong", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 3, SteamCMDBackoffMillis: 1},
+	}
+	st := state.State{Mods: map[string]state.ModState{}, Servers: map[string]state.ServerState{}}
+
+	_, err := NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st)
+	if !StopsBatch(err) || runs() != 1 {
+		t.Fatalf("expected one run and a batch-stopping error, got %d runs, %v", runs(), err)
+	}
+	if st.Steam.Accounts["bob"].LoginBlocked == nil || st.Steam.LastFailureKind != string(FailureInvalidPassword) {
+		t.Fatalf("expected login block in state, got %#v", st.Steam)
+	}
+
+	_, err = NewRunner(cfg).UpdateMods(context.Background(), []string{"2"}, &st)
+	if !errors.Is(err, ErrLoginBlocked) || runs() != 1 {
+		t.Fatalf("expected blocked run, got %d runs, %v", runs(), err)
+	}
+
+	cfg.Steam.Password = "fixed"
+	_, _ = NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))).UpdateMods(context.Background(), []string{"2"}, &st)
+	if runs() != 2 {
+		t.Fatalf("expected steamcmd to run after the password changed, got %d runs", runs())
+	}
+}
+
+func TestUpdateModsRateLimitCooldown(t *testing.T) {
+	root := t.TempDir()
+	script, runs := fakeSteamCMD(t, root, "FAILED login with result code Rate Limit Exceeded")
+	cfg := config.Config{
+		Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: script, SteamcmdWorkshopContentRoot: filepath.Join(root, "content")},
+		Steam: config.SteamConfig{Login: "bob", Password: "pw", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 3, SteamCMDBackoffMillis: 1, AccountCooldownMinutes: 15},
+	}
+	st := state.State{Mods: map[string]state.ModState{}, Servers: map[string]state.ServerState{}}
+
+	if _, err := NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st); !StopsBatch(err) {
+		t.Fatalf("expected batch-stopping error, got %v", err)
+	}
+	if st.Steam.Accounts["bob"].CooldownUntil == nil || runs() != 1 {
+		t.Fatalf("expected one run and a cooldown, got %d runs, %#v", runs(), st.Steam)
+	}
+	if _, err := NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st); !errors.Is(err, ErrRateLimited) || runs() != 1 {
+		t.Fatalf("expected run to be refused during cooldown, got %d runs, %v", runs(), err)
+	}
+	past := time.Now().Add(-time.Minute)
+	st.Steam.Accounts["bob"] = state.SteamAccountState{CooldownUntil: &past}
+	_, _ = NewRunner(cfg).UpdateMods(context.Background(), []string{"1"}, &st)
+	if runs() != 2 {
+		t.Fatalf("expected steamcmd to run after the cooldown, got %d runs", runs())
+	}
+}
+
+func TestUpdateModsKillsHungSteamCMD(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	cases := []struct {
+		name   string
+		script string
+		cfg    func(*config.SteamConfig)
+	}{
+		// The background sleep keeps the output pipe open, so Wait only
+		// returns quickly if the whole process group is killed.
+		{"idle", "#!/bin/sh\necho 'Downloading item 1 ...'\nsleep 30 &\nsleep 30\n", func(c *config.SteamConfig) { c.SteamCMDIdleTimeoutSeconds = 1 }},
+		{"overall", "#!/bin/sh\nwhile true; do echo 'Downloading item 1 ...'; sleep 0.2; done\n", func(c *config.SteamConfig) { c.SteamCMDTimeoutSeconds = 1 }},
+	}
+	for _, tc := range cases {
+		root := t.TempDir()
+		script := filepath.Join(root, "steamcmd.sh")
+		if err := os.WriteFile(script, []byte(tc.script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		cfg := config.Config{
+			Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: script, SteamcmdWorkshopContentRoot: filepath.Join(root, "content")},
+			Steam: config.SteamConfig{Login: "bob", Password: "pw", WorkshopGameID: 221100, SteamCMDRetriesPerMod: 1},
+		}
+		tc.cfg(&cfg.Steam)
+		st := state.State{
+			Mods:    map[string]state.ModState{"1": {FolderSlug: "cf"}},
+			Servers: map[string]state.ServerState{"s1": {LastModIDs: []string{"1"}}},
+		}
+
+		start := time.Now()
+		_, err := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))).UpdateMods(context.Background(), []string{"1"}, &st)
+		if elapsed := time.Since(start); elapsed > 4*time.Second {
+			t.Fatalf("%s: hung steamcmd took %s to stop", tc.name, elapsed)
+		}
+		var failure *Failure
+		var hang *HangError
+		if !errors.As(err, &failure) || failure.Kind != FailureHung || !errors.As(err, &hang) {
+			t.Fatalf("%s: expected hung failure, got %v", tc.name, err)
+		}
+		if st.Steam.HangCount != 1 || st.Steam.LastHangAt == nil {
+			t.Fatalf("%s: expected hang counter in state, got %#v", tc.name, st.Steam)
+		}
+		if got := st.Servers["s1"]; got.LastErrorStage != "steamcmd_download" {
+			t.Fatalf("%s: unexpected server state: %#v", tc.name, got)
+		}
+	}
+}
+
+func fakeSteamCMDTarball(t *testing.T, files map[string]string) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func TestUpdateModsBootstrapsMissingSteamCMD(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	root := t.TempDir()
+	installDir := filepath.Join(root, "steamcmd")
+	tarball, sum := fakeSteamCMDTarball(t, map[string]string{
+		// The first run "self-updates" and exits 7 like SteamCMD does.
+		"steamcmd.sh":       "#!/bin/sh\nif [ \"$1\" = +quit ]; then touch \"$(dirname \"$0\")/updated\"; exit 7; fi\necho 'Success. Downloaded item 1'\n",
+		"linux32/steamcmd":  "elf",
+		"linux32/libstd.so": "lib",
+	})
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(tarball)
+	}))
+	defer srv.Close()
+
+	content := filepath.Join(root, "content", "221100", "1", "addons")
+	if err := os.MkdirAll(content, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeMinimalPBO(t, filepath.Join(content, "cf.pbo"))
+	cfg := config.Config{
+		Paths: config.PathsConfig{
+			LocalModsRoot:               filepath.Join(root, "mods"),
+			LocalCacheRoot:              filepath.Join(root, "cache"),
+			SteamcmdPath:                filepath.Join(installDir, "steamcmd.sh"),
+			SteamcmdWorkshopContentRoot: filepath.Join(root, "content"),
+		},
+		Steam: config.SteamConfig{
+			Login:                 "bob",
+			Password:              "pw",
+			WorkshopGameID:        221100,
+			SteamCMDRetriesPerMod: 1,
+			UnsignedMods:          []string{"1"},
+			Bootstrap:             config.SteamCMDBootstrapConfig{Enabled: true, URL: srv.URL + "/steamcmd_linux.tar.gz", SHA256: sum},
+		},
+	}
+	st := state.State{Mods: map[string]state.ModState{"1": {FolderSlug: "cf"}}, Servers: map[string]state.ServerState{}}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatalf("update mods: %v", err)
+	}
+	for _, p := range []string{"steamcmd.sh", "linux32/steamcmd", "linux32/libstd.so", "updated"} {
+		if _, err := os.Stat(filepath.Join(installDir, p)); err != nil {
+			t.Fatalf("expected %s after bootstrap: %v", p, err)
+		}
+	}
+	if st.Mods["1"].LocalUpdatedAt.IsZero() {
+		t.Fatal("expected mod to be downloaded with the bootstrapped steamcmd")
+	}
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil || requests != 1 {
+		t.Fatalf("expected no second download, got %d requests, %v", requests, err)
+	}
+}
+
+func TestBootstrapRejectsChecksumMismatch(t *testing.T) {
+	root := t.TempDir()
+	tarball, _ := fakeSteamCMDTarball(t, map[string]string{"steamcmd.sh": "#!/bin/sh\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarball)
+	}))
+	defer srv.Close()
+	cfg := config.Config{
+		Paths: config.PathsConfig{LocalCacheRoot: root, SteamcmdPath: filepath.Join(root, "steamcmd", "steamcmd.sh")},
+		Steam: config.SteamConfig{Bootstrap: config.SteamCMDBootstrapConfig{Enabled: true, URL: srv.URL, SHA256: strings.Repeat("0", 64)}},
+	}
+	err := NewRunner(cfg).ensureInstalled(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "steamcmd"))
+	if len(entries) != 0 {
+		t.Fatalf("expected nothing installed, got %v", entries)
+	}
+}
+
+func TestInstallTarballRejectsUnsafePaths(t *testing.T) {
+	dir := t.TempDir()
+	tarball, _ := fakeSteamCMDTarball(t, map[string]string{"steamcmd.sh": "x", "../escape": "x"})
+	err := installTarball(bytes.NewReader(tarball), dir, "steamcmd.sh")
+	if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Fatalf("expected unsafe path error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "steamcmd.sh")); !os.IsNotExist(err) {
+		t.Fatal("binary must not be installed from a rejected tarball")
+	}
+}
+
+// writeMinimalPBO writes a readable PBO: one 1-byte entry "a", the
+// terminating entry, then its data.
+func writeMinimalPBO(t *testing.T, p string) {
+	t.Helper()
+	pbo := append([]byte("a\x00"), 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0)
+	pbo = append(pbo, make([]byte, 21)...)
+	pbo = append(pbo, 'x')
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, pbo, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// accountPoolFixture returns a config whose fake SteamCMD logs "HOME args"
+// per run and answers with the output mapped to the login, or success.
+func accountPoolFixture(t *testing.T, failures map[string]string) (config.Config, func() []string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake steamcmd is a shell script")
+	}
+	root := t.TempDir()
+	runs := filepath.Join(root, "runs")
+	var cases strings.Builder
+	for login, output := range failures {
+		fmt.Fprintf(&cases, "  *\"+login %s \"*|*\"+login %s\") echo '%s'; exit 0 ;;\n", login, login, output)
+	}
+	script := filepath.Join(root, "steamcmd.sh")
+	body := "#!/bin/sh\necho \"$HOME $*\" >> '" + runs + "'\ncase \"$*\" in\n" + cases.String() + "esac\necho 'Success. Downloaded item 1'\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	contentRoot := filepath.Join(root, "steam", "steamapps", "workshop", "content")
+	writeMinimalPBO(t, filepath.Join(contentRoot, "221100", "1", "addons", "cf.pbo"))
+	cfg := config.Config{
+		Paths: config.PathsConfig{
+			LocalModsRoot:               filepath.Join(root, "mods"),
+			LocalCacheRoot:              filepath.Join(root, "cache"),
+			SteamcmdPath:                script,
+			SteamcmdWorkshopContentRoot: contentRoot,
+		},
+		Steam: config.SteamConfig{
+			WorkshopGameID:         221100,
+			SteamCMDRetriesPerMod:  1,
+			UnsignedMods:           []string{"1"},
+			AccountStrategy:        config.AccountStrategyFailover,
+			AccountCooldownMinutes: 15,
+			Accounts:               []config.SteamAccountConfig{{Login: "alice", Password: "pa"}, {Login: "bob", Password: "pb"}},
+		},
+	}
+	return cfg, func() []string {
+		b, _ := os.ReadFile(runs)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+}
+
+func TestUpdateModsFailsOverToNextAccount(t *testing.T) {
+	cfg, runs := accountPoolFixture(t, map[string]string{"alice": "FAILED login with result code Rate Limit Exceeded"})
+	st := state.State{Mods: map[string]state.ModState{"1": {FolderSlug: "cf"}}, Servers: map[string]state.ServerState{}}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatalf("update mods: %v", err)
+	}
+	got := runs()
+	if len(got) != 2 {
+		t.Fatalf("expected a run per account, got %q", got)
+	}
+	installDir := filepath.Dir(filepath.Dir(filepath.Dir(cfg.Paths.SteamcmdWorkshopContentRoot)))
+	for i, login := range []string{"alice", "bob"} {
+		home := filepath.Join(cfg.Paths.LocalCacheRoot, "steam-accounts", login)
+		if !strings.HasPrefix(got[i], home+" +force_install_dir "+installDir+" +login "+login+" ") {
+			t.Fatalf("run %d: unexpected home/args %q", i, got[i])
+		}
+	}
+	if st.Steam.Accounts["alice"].CooldownUntil == nil || st.Steam.Accounts["bob"].LastUsedAt == nil {
+		t.Fatalf("unexpected account state: %#v", st.Steam.Accounts)
+	}
+	if st.Mods["1"].LocalUpdatedAt.IsZero() {
+		t.Fatal("expected mod to be downloaded with the second account")
+	}
+
+	// alice is cooling down, so the next download goes straight to bob.
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatal(err)
+	}
+	if got := runs(); len(got) != 3 || !strings.Contains(got[2], "+login bob ") {
+		t.Fatalf("expected only bob to run, got %q", got)
+	}
+}
+
+func TestUpdateModsRoundRobinAccounts(t *testing.T) {
+	cfg, runs := accountPoolFixture(t, nil)
+	cfg.Steam.AccountStrategy = config.AccountStrategyRoundRobin
+	st := state.State{Mods: map[string]state.ModState{"1": {FolderSlug: "cf"}}, Servers: map[string]state.ServerState{}}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := 0; i < 3; i++ {
+		if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := runs()
+	for i, login := range []string{"alice", "bob", "alice"} {
+		if !strings.Contains(got[i], "+login "+login+" ") {
+			t.Fatalf("run %d: expected %s, got %q", i, login, got)
+		}
+	}
+}
+
+func TestUpdateModsAnonymousGenericFailureDoesNotRequireLogin(t *testing.T) {
+	cfg, runs := accountPoolFixture(t, map[string]string{"anonymous": "ERROR! Download item 1 failed (Failure)."})
+	cfg.Steam.Anonymous = true
+	st := state.State{Mods: map[string]state.ModState{"1": {FolderSlug: "cf"}}, Servers: map[string]state.ServerState{}}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatalf("update mods: %v", err)
+	}
+	if st.Mods["1"].RequiresLogin {
+		t.Fatal("a generic failure must not mark the mod as requiring a login")
+	}
+	before := len(runs())
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatal(err)
+	}
+	if got := runs(); len(got) <= before || !strings.Contains(got[before], "+login anonymous ") {
+		t.Fatalf("expected anonymous to be tried again, got %q", got)
+	}
+}
+
+func TestUpdateModsAnonymousFallsBackToLogin(t *testing.T) {
+	cfg, runs := accountPoolFixture(t, map[string]string{"anonymous": "ERROR! Download item 1 failed (No subscription)"})
+	cfg.Steam.Anonymous = true
+	st := state.State{Mods: map[string]state.ModState{"1": {FolderSlug: "cf"}}, Servers: map[string]state.ServerState{}}
+	runner := NewRunner(cfg).WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatalf("update mods: %v", err)
+	}
+	got := runs()
+	if len(got) != 2 || !strings.Contains(got[0], "+login anonymous +workshop_download_item") || !strings.Contains(got[1], "+login alice pa") {
+		t.Fatalf("expected anonymous then alice, got %q", got)
+	}
+	if !st.Mods["1"].RequiresLogin {
+		t.Fatal("expected mod to be marked as requiring a login")
+	}
+	if _, err := runner.UpdateMods(context.Background(), []string{"1"}, &st); err != nil {
+		t.Fatal(err)
+	}
+	if got := runs(); len(got) != 3 || strings.Contains(got[2], "anonymous") {
+		t.Fatalf("expected anonymous to be skipped, got %q", got)
+	}
+}
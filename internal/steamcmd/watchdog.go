@@ -0,0 +1,97 @@
+package steamcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// HangError is the cancel cause when the watchdog kills SteamCMD.
+type HangError struct {
+	Reason string
+}
+
+func (e *HangError) Error() string {
+	return "steamcmd hung: " + e.Reason
+}
+
+// activityReader records when SteamCMD last wrote output.
+type activityReader struct {
+	r    io.Reader
+	last atomic.Int64
+}
+
+func newActivityReader(r io.Reader) *activityReader {
+	a := &activityReader{r: r}
+	a.touch()
+	return a
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.touch()
+	}
+	return n, err
+}
+
+func (a *activityReader) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+func (a *activityReader) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, a.last.Load()))
+}
+
+// watchIdle cancels the run with a HangError once SteamCMD has neither
+// written output nor grown its download directory for idleTimeout.
+// SteamCMD is often silent while downloading a large item, so growth of
+// downloadDir counts as activity.
+func watchIdle(ctx context.Context, cancel context.CancelCauseFunc, activity *activityReader, downloadDir string, idleTimeout time.Duration) {
+	tick := min(max(idleTimeout/4, 100*time.Millisecond), 15*time.Second)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	lastSize := dirSize(downloadDir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if size := dirSize(downloadDir); size != lastSize {
+				lastSize = size
+				activity.touch()
+				continue
+			}
+			if activity.idle(now) >= idleTimeout {
+				cancel(&HangError{Reason: fmt.Sprintf("no output or download progress for %s", idleTimeout)})
+				return
+			}
+		}
+	}
+}
+
+// downloadDir is where SteamCMD stages an item before moving it into
+// workshop/content.
+func downloadDir(workshopContentRoot, appID, modID string) string {
+	return filepath.Join(filepath.Dir(workshopContentRoot), "downloads", appID, modID)
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,201 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/dayz-standalone-mode-updater/internal/config"
+	"github.com/example/dayz-standalone-mode-updater/internal/state"
+)
+
+const (
+	// maxChangelogChars caps the changelog text kept in state.
+	maxChangelogChars = 4000
+	// changelogRetryInterval spaces attempts for a version whose changelog
+	// could not be fetched or has no entry yet.
+	changelogRetryInterval = 30 * time.Minute
+)
+
+var (
+	// Each entry of the changelog page is <p id="<time_updated>">text</p>.
+	changelogEntryPattern = regexp.MustCompile(`(?s)<p\s+id="([0-9]+)"\s*>(.*?)</p>`)
+	lineBreakPattern      = regexp.MustCompile(`(?i)<br\s*/?>`)
+	tagPattern            = regexp.MustCompile(`<[^>]*>`)
+)
+
+type ChangelogFetcher interface {
+	// FetchChangelog returns the changelog entry of modID for updatedAt, or
+	// "" when the page has no entry for it.
+	FetchChangelog(ctx context.Context, modID string, updatedAt time.Time) (string, error)
+}
+
+// ChangelogClient reads changelog entries from the Workshop changelog page.
+// It has its own limiter (the page is on another host than the Web API) with
+// the same request rate and circuit breaker settings.
+type ChangelogClient struct {
+	httpClient *http.Client
+	baseURL    string
+	limiter    *limiter
+}
+
+func NewChangelogClient(cfg config.SteamConfig) *ChangelogClient {
+	timeout := time.Duration(cfg.WorkshopHTTPTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	return &ChangelogClient{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimSuffix(cfg.Changelog.BaseURL, "/"),
+		limiter:    newLimiter(cfg.WorkshopRequestsPerMinute, cfg.WorkshopBreakerThreshold, time.Duration(cfg.WorkshopBreakerCooldownSeconds)*time.Second),
+	}
+}
+
+func (c *ChangelogClient) FetchChangelog(ctx context.Context, modID string, updatedAt time.Time) (string, error) {
+	if err := c.limiter.allow(); err != nil {
+		return "", err
+	}
+	text, err := c.fetch(ctx, modID, updatedAt)
+	c.limiter.record(err)
+	return text, err
+}
+
+// fetch makes a single attempt; a Retry-After holds back the following
+// requests and the failed version is retried after changelogRetryInterval.
+func (c *ChangelogClient) fetch(ctx context.Context, modID string, updatedAt time.Time) (string, error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/"+modID, nil)
+	if err != nil {
+		return "", fmt.Errorf("create changelog request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request changelog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("changelog page returned status %d", resp.StatusCode)
+		if wait, ok := retryAfter(resp, c.limiter.now()); ok {
+			if wait > maxRetryAfterWait {
+				c.limiter.open(c.limiter.now().Add(wait))
+			} else {
+				c.limiter.pause(wait)
+			}
+		}
+		return "", err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", fmt.Errorf("read changelog page: %w", err)
+	}
+	return parseChangelog(string(body), updatedAt), nil
+}
+
+// parseChangelog returns the plain text of the entry for updatedAt.
+func parseChangelog(page string, updatedAt time.Time) string {
+	want := strconv.FormatInt(updatedAt.Unix(), 10)
+	for _, m := range changelogEntryPattern.FindAllStringSubmatch(page, -1) {
+		if m[1] == want {
+			return changelogText(m[2])
+		}
+	}
+	return ""
+}
+
+func changelogText(entry string) string {
+	entry = lineBreakPattern.ReplaceAllString(entry, "\n")
+	entry = html.UnescapeString(tagPattern.ReplaceAllString(entry, ""))
+	var lines []string
+	for _, line := range strings.Split(entry, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	if runes := []rune(text); len(runes) > maxChangelogChars {
+		text = string(runes[:maxChangelogChars])
+	}
+	return text
+}
+
+// ChangelogRequest asks for the changelog entry of ModID's version UpdatedAt.
+type ChangelogRequest struct {
+	ModID     string
+	UpdatedAt time.Time
+}
+
+type ChangelogResult struct {
+	ChangelogRequest
+	Text string
+	Err  error
+}
+
+// DueChangelogs returns the mods in modIDs whose changelog for the current
+// Workshop version is missing and was not attempted within
+// changelogRetryInterval.
+func DueChangelogs(st *state.State, modIDs []string, now time.Time) []ChangelogRequest {
+	var due []ChangelogRequest
+	for _, id := range modIDs {
+		mod := st.Mods[id]
+		if mod.WorkshopUpdatedAt.IsZero() || mod.ChangelogUpdatedAt.Equal(mod.WorkshopUpdatedAt) {
+			continue
+		}
+		if !mod.ChangelogCheckedAt.IsZero() && now.Sub(mod.ChangelogCheckedAt) < changelogRetryInterval {
+			continue
+		}
+		due = append(due, ChangelogRequest{ModID: id, UpdatedAt: mod.WorkshopUpdatedAt})
+	}
+	return due
+}
+
+// FetchChangelogs fetches the requested entries without touching state, so
+// callers can run it outside a state update.
+func FetchChangelogs(ctx context.Context, fetcher ChangelogFetcher, due []ChangelogRequest) []ChangelogResult {
+	results := make([]ChangelogResult, 0, len(due))
+	for _, req := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		text, err := fetcher.FetchChangelog(ctx, req.ModID, req.UpdatedAt)
+		results = append(results, ChangelogResult{ChangelogRequest: req, Text: text, Err: err})
+	}
+	return results
+}
+
+// ApplyChangelogs stores fetched entries and stamps every attempt. Results for
+// a version that is no longer current are dropped. The returned error joins
+// the failed fetches.
+func ApplyChangelogs(st *state.State, results []ChangelogResult, now time.Time) error {
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("mod %s: %w", res.ModID, res.Err))
+		}
+		mod, ok := st.Mods[res.ModID]
+		if !ok || !mod.WorkshopUpdatedAt.Equal(res.UpdatedAt) || errors.Is(res.Err, context.Canceled) {
+			continue
+		}
+		mod.ChangelogCheckedAt = now.UTC()
+		switch {
+		case res.Err != nil:
+		case res.Text == "":
+			// Not published yet; drop the previous version's entry and
+			// try again after changelogRetryInterval.
+			mod.Changelog = ""
+		default:
+			mod.Changelog = res.Text
+			mod.ChangelogUpdatedAt = res.UpdatedAt
+		}
+		st.Mods[res.ModID] = mod
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package workshop
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PublishedFileClient uses IPublishedFileService/GetDetails, which needs an
+// API key but also reports child items (required mods).
+type PublishedFileClient struct {
+	retrier
+	apiKey   string
+	endpoint string
+}
+
+func NewPublishedFileClient(apiKey string, timeout time.Duration, maxRetries int, backoff time.Duration) *PublishedFileClient {
+	return &PublishedFileClient{
+		retrier:  newRetrier(timeout, maxRetries, backoff),
+		apiKey:   apiKey,
+		endpoint: "https://api.steampowered.com/IPublishedFileService/GetDetails/v1/",
+	}
+}
+
+func (c *PublishedFileClient) FetchMetadata(ctx context.Context, modIDs []string) (map[string]ModMetadata, error) {
+	if len(modIDs) == 0 {
+		return map[string]ModMetadata{}, nil
+	}
+
+	vals := url.Values{}
+	vals.Set("includetags", "true")
+	vals.Set("includechildren", "true")
+	vals.Set("strip_description_bbcode", "true")
+	for i, id := range modIDs {
+		vals.Set(fmt.Sprintf("publishedfileids[%d]", i), id)
+	}
+
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"?"+vals.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		// The key goes in a header so it never shows up in the request URL,
+		// which transport errors quote.
+		req.Header.Set("x-webapi-key", c.apiKey)
+		return req, nil
+	}, parseMetadataResponse)
+}
@@ -0,0 +1,164 @@
+package workshop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBackoff caps the exponential retry backoff.
+	maxBackoff = time.Minute
+	// maxRetryAfterWait is the longest Retry-After a fetch waits out; a
+	// longer one opens the circuit breaker until it has passed.
+	maxRetryAfterWait = time.Minute
+)
+
+var ErrCircuitOpen = errors.New("workshop api circuit breaker open")
+
+// CircuitOpenError is returned without a request while the breaker is open.
+type CircuitOpenError struct {
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrCircuitOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// limiter is shared by all requests of a client and kept between polls. It
+// spaces requests evenly, holds every request back while the API asked to
+// slow down (Retry-After) and opens a circuit breaker after threshold fetches
+// in a row failed. After the cooldown the next fetch is let through; another
+// failure opens the breaker again right away.
+type limiter struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	threshold int
+	cooldown  time.Duration
+	next      time.Time
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// newLimiter returns a limiter allowing requestsPerMinute requests; zero
+// values disable pacing and the breaker.
+func newLimiter(requestsPerMinute, threshold int, cooldown time.Duration) *limiter {
+	l := &limiter{threshold: threshold, cooldown: cooldown, now: time.Now}
+	if requestsPerMinute > 0 {
+		l.interval = time.Minute / time.Duration(requestsPerMinute)
+	}
+	return l
+}
+
+// allow fails fast while the breaker is open.
+func (l *limiter) allow() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.openUntil; l.now().Before(until) {
+		return &CircuitOpenError{Until: until}
+	}
+	return nil
+}
+
+// wait reserves the next request slot and sleeps until it is due.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleep(ctx, at.Sub(now))
+}
+
+// pause holds back all requests for d.
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+// open opens the breaker until the given time.
+func (l *limiter) open(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.openUntil) {
+		l.openUntil = until
+	}
+}
+
+// record counts the outcome of a fetch towards the breaker.
+func (l *limiter) record(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		l.failures = 0
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	l.failures++
+	if l.threshold > 0 && l.failures >= l.threshold {
+		if until := l.now().Add(l.cooldown); until.After(l.openUntil) {
+			l.openUntil = until
+		}
+	}
+}
+
+// backoffDelay is base * 2^(attempt-1), capped at maxBackoff, with jitter
+// over its upper half.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	if half := d / 2; half > 0 {
+		return half + rand.N(half+1)
+	}
+	return d
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
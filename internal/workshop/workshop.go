@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,24 +19,71 @@ import (
 )
 
 type ModMetadata struct {
-	ID        string
-	Title     string
-	UpdatedAt time.Time
+	ID         string
+	Title      string
+	UpdatedAt  time.Time
+	CreatedAt  time.Time
+	FileSize   int64
+	PreviewURL string
+	Tags       []string
+	// ChildIDs are the items the mod requires; only the
+	// published_file_service backend reports them.
+	ChildIDs   []string
+	Banned     bool
+	BanReason  string
+	Visibility int
+	// Revision is GetDetails' revision_change_number, which grows with every
+	// change to the item; the remote_storage backend leaves it zero.
+	Revision int64
 }
 
 type Client interface {
 	FetchMetadata(ctx context.Context, modIDs []string) (map[string]ModMetadata, error)
 }
 
+// NewClient returns the client for steam.workshop_backend, rate limited per
+// steam.workshop_requests_per_minute and guarded by a circuit breaker.
+func NewClient(cfg config.SteamConfig) Client {
+	timeout := time.Duration(cfg.WorkshopHTTPTimeoutSeconds) * time.Second
+	backoff := time.Duration(cfg.WorkshopBackoffMillis) * time.Millisecond
+	limit := newLimiter(cfg.WorkshopRequestsPerMinute, cfg.WorkshopBreakerThreshold, time.Duration(cfg.WorkshopBreakerCooldownSeconds)*time.Second)
+	if cfg.WorkshopBackend == config.WorkshopBackendPublishedFileService {
+		c := NewPublishedFileClient(cfg.WebAPIKey, timeout, cfg.WorkshopMaxRetries, backoff)
+		c.limiter = limit
+		return c
+	}
+	c := NewWebAPIClient(cfg.WebAPIKey, timeout, cfg.WorkshopMaxRetries, backoff)
+	c.limiter = limit
+	return c
+}
+
+// WebAPIClient uses the legacy ISteamRemoteStorage/GetPublishedFileDetails
+// endpoint, which works without an API key.
 type WebAPIClient struct {
+	retrier
+	apiKey   string
+	endpoint string
+}
+
+func NewWebAPIClient(apiKey string, timeout time.Duration, maxRetries int, backoff time.Duration) *WebAPIClient {
+	return &WebAPIClient{
+		retrier:  newRetrier(timeout, maxRetries, backoff),
+		apiKey:   apiKey,
+		endpoint: "https://api.steampowered.com/ISteamRemoteStorage/GetPublishedFileDetails/v1/",
+	}
+}
+
+// retrier sends workshop API requests through the client's limiter,
+// retrying network errors, 429 and 5xx with exponential backoff or after the
+// response's Retry-After.
+type retrier struct {
 	httpClient *http.Client
-	apiKey     string
-	endpoint   string
 	maxRetries int
 	backoff    time.Duration
+	limiter    *limiter
 }
 
-func NewWebAPIClient(apiKey string, timeout time.Duration, maxRetries int, backoff time.Duration) *WebAPIClient {
+func newRetrier(timeout time.Duration, maxRetries int, backoff time.Duration) retrier {
 	if timeout <= 0 {
 		timeout = 20 * time.Second
 	}
@@ -45,13 +93,7 @@ func NewWebAPIClient(apiKey string, timeout time.Duration, maxRetries int, backo
 	if backoff <= 0 {
 		backoff = 500 * time.Millisecond
 	}
-	return &WebAPIClient{
-		httpClient: &http.Client{Timeout: timeout},
-		apiKey:     apiKey,
-		endpoint:   "https://api.steampowered.com/ISteamRemoteStorage/GetPublishedFileDetails/v1/",
-		maxRetries: maxRetries,
-		backoff:    backoff,
-	}
+	return retrier{httpClient: &http.Client{Timeout: timeout}, maxRetries: maxRetries, backoff: backoff, limiter: newLimiter(0, 0, 0)}
 }
 
 func (c *WebAPIClient) FetchMetadata(ctx context.Context, modIDs []string) (map[string]ModMetadata, error) {
@@ -68,27 +110,66 @@ func (c *WebAPIClient) FetchMetadata(ctx context.Context, modIDs []string) (map[
 		vals.Set(fmt.Sprintf("publishedfileids[%d]", i), id)
 	}
 
+	return c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewBufferString(vals.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}, parseMetadataResponse)
+}
+
+func (c retrier) do(ctx context.Context, newRequest func() (*http.Request, error), parse func(*http.Response) (map[string]ModMetadata, error)) (map[string]ModMetadata, error) {
+	if err := c.limiter.allow(); err != nil {
+		return nil, err
+	}
+	meta, err := c.fetch(ctx, newRequest, parse)
+	c.limiter.record(err)
+	return meta, err
+}
+
+func (c retrier) fetch(ctx context.Context, newRequest func() (*http.Request, error), parse func(*http.Response) (map[string]ModMetadata, error)) (map[string]ModMetadata, error) {
 	var lastErr error
 	for attempt := 1; attempt <= c.maxRetries; attempt++ {
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewBufferString(vals.Encode()))
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := newRequest()
 		if err != nil {
 			return nil, fmt.Errorf("create workshop request: %w", err)
 		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
+		delay := backoffDelay(c.backoff, attempt)
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
+			// *url.Error quotes the request URL, which may carry an API key.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
 			lastErr = fmt.Errorf("request workshop metadata: %w", err)
 		} else {
 			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
 				lastErr = fmt.Errorf("workshop api returned status %d", resp.StatusCode)
+				wait, ok := retryAfter(resp, c.limiter.now())
 				resp.Body.Close()
+				if ok && wait > maxRetryAfterWait {
+					until := c.limiter.now().Add(wait)
+					c.limiter.open(until)
+					return nil, fmt.Errorf("%w, retry after %s", lastErr, until.Format(time.RFC3339))
+				}
+				if ok {
+					// Every request waits, not just this one.
+					c.limiter.pause(wait)
+					delay = 0
+				}
 			} else if resp.StatusCode >= 300 {
 				err := fmt.Errorf("workshop api returned status %d", resp.StatusCode)
 				resp.Body.Close()
 				return nil, err
 			} else {
-				meta, err := parseMetadataResponse(resp)
+				meta, err := parse(resp)
 				resp.Body.Close()
 				if err != nil {
 					return nil, err
@@ -100,49 +181,83 @@ func (c *WebAPIClient) FetchMetadata(ctx context.Context, modIDs []string) (map[
 		if attempt == c.maxRetries || errors.Is(lastErr, context.Canceled) || errors.Is(lastErr, context.DeadlineExceeded) {
 			break
 		}
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(c.backoff * time.Duration(attempt)):
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
 		}
 	}
 
 	return nil, lastErr
 }
 
+// PollMetadata checks the mods that are due, applies the results to st and
+// returns the mods that need a local update. It holds st for the whole
+// network round trip; the orchestrator uses DueForPoll, FetchPoll and
+// MetadataPoll.Apply instead so the state lock is only held to apply.
 func PollMetadata(ctx context.Context, cfg config.Config, st *state.State, client Client, now time.Time) ([]string, error) {
-	candidateSet := make(map[string]struct{})
-	for _, srv := range st.Servers {
-		for _, id := range srv.LastModIDs {
-			if id != "" {
-				candidateSet[id] = struct{}{}
-			}
-		}
+	poll, err := FetchPoll(ctx, cfg, client, DueForPoll(cfg, st, now))
+	if err != nil {
+		return nil, err
 	}
-	candidateModIDs := mapKeys(candidateSet)
+	return poll.Apply(st, now)
+}
 
-	pollEvery := time.Duration(cfg.Intervals.WorkshopPollSeconds) * time.Second
-	idsToCheck := make([]string, 0, len(candidateModIDs))
-	for _, id := range candidateModIDs {
+// DueForPoll returns the listed mods whose poll interval has passed.
+func DueForPoll(cfg config.Config, st *state.State, now time.Time) []string {
+	idsToCheck := make([]string, 0)
+	for _, id := range listedMods(st) {
 		mod := st.Mods[id]
-		if !mod.LastWorkshopCheckAt.IsZero() && now.Sub(mod.LastWorkshopCheckAt) < pollEvery {
+		if !mod.LastWorkshopCheckAt.IsZero() && now.Sub(mod.LastWorkshopCheckAt) < PollInterval(cfg.Intervals, mod, now) {
 			continue
 		}
 		idsToCheck = append(idsToCheck, id)
 	}
+	return idsToCheck
+}
+
+// MetadataPoll is the network half of a poll, ready to be applied to state.
+type MetadataPoll struct {
+	ids     []string
+	results map[string]ModMetadata
+	failed  []BatchError
+}
 
-	results, err := fetchBatched(ctx, client, idsToCheck, cfg.Concurrency.WorkshopBatchSize, cfg.Concurrency.WorkshopParallelism)
+// FetchPoll requests metadata for ids without touching state.
+func FetchPoll(ctx context.Context, cfg config.Config, client Client, ids []string) (*MetadataPoll, error) {
+	results, failed, err := fetchBatched(ctx, client, ids, cfg.Concurrency.WorkshopBatchSize, cfg.Concurrency.WorkshopParallelism)
 	if err != nil {
 		return nil, err
 	}
+	return &MetadataPoll{ids: ids, results: results, failed: failed}, nil
+}
+
+// Apply stores the poll results in st and returns the listed mods that need a
+// local update, with a *PollError if some batches failed.
+func (p *MetadataPoll) Apply(st *state.State, now time.Time) ([]string, error) {
+	failedErr := make(map[string]error)
+	for _, batch := range p.failed {
+		for _, id := range batch.ModIDs {
+			failedErr[id] = batch.Err
+		}
+	}
 
-	for _, id := range idsToCheck {
+	for _, id := range p.ids {
 		mod := st.Mods[id]
+		if err, ok := failedErr[id]; ok {
+			// Not stamped as checked, so the next poll retries it.
+			mod.LastWorkshopError = err.Error()
+			st.Mods[id] = mod
+			continue
+		}
 		mod.LastWorkshopCheckAt = now.UTC()
-		if meta, ok := results[id]; ok {
+		mod.LastWorkshopError = ""
+		if meta, ok := p.results[id]; ok {
 			if meta.Title != "" {
 				mod.LastTitle = meta.Title
 			}
+			if meta.FileSize > 0 {
+				mod.FileSize = meta.FileSize
+			}
+			applyDetails(&mod, meta)
 			if meta.UpdatedAt.After(mod.WorkshopUpdatedAt) {
 				mod.WorkshopUpdatedAt = meta.UpdatedAt.UTC()
 			}
@@ -151,18 +266,104 @@ func PollMetadata(ctx context.Context, cfg config.Config, st *state.State, clien
 	}
 
 	modsToUpdateLocally := make([]string, 0)
-	for _, id := range candidateModIDs {
+	for _, id := range listedMods(st) {
 		if needsLocalUpdate(st.Mods[id]) {
 			modsToUpdateLocally = append(modsToUpdateLocally, id)
 		}
 	}
-	sort.Strings(modsToUpdateLocally)
+	if len(p.failed) > 0 {
+		return modsToUpdateLocally, &PollError{Batches: p.failed, Requested: len(p.ids)}
+	}
 	return modsToUpdateLocally, nil
 }
 
-func fetchBatched(ctx context.Context, client Client, ids []string, batchSize int, parallelism int) (map[string]ModMetadata, error) {
+// listedMods returns the union of all servers' modlists, sorted.
+func listedMods(st *state.State) []string {
+	set := make(map[string]struct{})
+	for _, srv := range st.Servers {
+		for _, id := range srv.LastModIDs {
+			if id != "" {
+				set[id] = struct{}{}
+			}
+		}
+	}
+	return mapKeys(set)
+}
+
+// BatchError is a metadata request that failed for all of its mods.
+type BatchError struct {
+	ModIDs []string
+	Err    error
+}
+
+// PollError reports the batches of a poll that failed. The other batches were
+// applied and PollMetadata still returns the mods to update.
+type PollError struct {
+	Batches   []BatchError
+	Requested int
+}
+
+func (e *PollError) Error() string {
+	seen := make(map[string]struct{})
+	var reasons []string
+	for _, b := range e.Batches {
+		msg := b.Err.Error()
+		if _, ok := seen[msg]; !ok {
+			seen[msg] = struct{}{}
+			reasons = append(reasons, msg)
+		}
+	}
+	return fmt.Sprintf("workshop metadata failed for %d of %d mods in %d batch(es): %s", len(e.FailedIDs()), e.Requested, len(e.Batches), strings.Join(reasons, "; "))
+}
+
+func (e *PollError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Batches))
+	for _, b := range e.Batches {
+		errs = append(errs, b.Err)
+	}
+	return errs
+}
+
+// FailedIDs returns the mods of all failed batches, sorted.
+func (e *PollError) FailedIDs() []string {
+	var ids []string
+	for _, b := range e.Batches {
+		ids = append(ids, b.ModIDs...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+const (
+	// Mods updated within recentlyUpdated are polled every
+	// workshop_poll_min_seconds, mods not updated for staleAfter every
+	// workshop_poll_max_seconds.
+	recentlyUpdated = 48 * time.Hour
+	staleAfter      = 30 * 24 * time.Hour
+)
+
+// PollInterval is how often mod is checked on the Workshop: more often right
+// after an update, when follow-up fixes are likely, and less often once it
+// has not changed for a long time.
+func PollInterval(intervals config.IntervalsConfig, mod state.ModState, now time.Time) time.Duration {
+	seconds := intervals.WorkshopPollSeconds
+	if !mod.WorkshopUpdatedAt.IsZero() {
+		age := now.Sub(mod.WorkshopUpdatedAt)
+		switch {
+		case age < recentlyUpdated && intervals.WorkshopPollMinSeconds > 0:
+			seconds = intervals.WorkshopPollMinSeconds
+		case age >= staleAfter && intervals.WorkshopPollMaxSeconds > 0:
+			seconds = intervals.WorkshopPollMaxSeconds
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// fetchBatched returns the metadata of the batches that succeeded and the
+// batches that failed; it only returns an error when ctx is done.
+func fetchBatched(ctx context.Context, client Client, ids []string, batchSize int, parallelism int) (map[string]ModMetadata, []BatchError, error) {
 	if len(ids) == 0 {
-		return map[string]ModMetadata{}, nil
+		return map[string]ModMetadata{}, nil, nil
 	}
 	if batchSize <= 0 {
 		batchSize = len(ids)
@@ -181,9 +382,9 @@ func fetchBatched(ctx context.Context, client Client, ids []string, batchSize in
 	}
 
 	out := make(map[string]ModMetadata, len(ids))
+	var failed []BatchError
 	var mu sync.Mutex
 	sem := make(chan struct{}, parallelism)
-	errCh := make(chan error, 1)
 	var wg sync.WaitGroup
 
 	for _, batch := range batches {
@@ -199,41 +400,76 @@ func fetchBatched(ctx context.Context, client Client, ids []string, batchSize in
 			defer func() { <-sem }()
 
 			meta, err := client.FetchMetadata(ctx, batch)
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				select {
-				case errCh <- err:
-				default:
-				}
+				failed = append(failed, BatchError{ModIDs: batch, Err: err})
 				return
 			}
-			mu.Lock()
 			for id, d := range meta {
 				out[id] = d
 			}
-			mu.Unlock()
 		}()
 	}
 
 	wg.Wait()
-	select {
-	case err := <-errCh:
-		return nil, err
-	default:
-	}
 	if err := ctx.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return out, nil
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ModIDs[0] < failed[j].ModIDs[0] })
+	return out, failed, nil
+}
+
+// publishedFileDetails is the part of a published file both endpoints
+// return in the same shape.
+type publishedFileDetails struct {
+	PublishedFileID string  `json:"publishedfileid"`
+	Result          int     `json:"result"`
+	Title           string  `json:"title"`
+	TimeCreated     int64   `json:"time_created"`
+	TimeUpdated     int64   `json:"time_updated"`
+	FileSize        flexInt `json:"file_size"`
+	PreviewURL      string  `json:"preview_url"`
+	Visibility      int     `json:"visibility"`
+	Banned          bool    `json:"banned"`
+	BanReason       string  `json:"ban_reason"`
+	Revision        flexInt `json:"revision_change_number"`
+	Tags            []struct {
+		Tag string `json:"tag"`
+	} `json:"tags"`
+	Children []struct {
+		PublishedFileID string `json:"publishedfileid"`
+	} `json:"children"`
+}
+
+func (d publishedFileDetails) metadata() ModMetadata {
+	meta := ModMetadata{
+		ID:         d.PublishedFileID,
+		Title:      d.Title,
+		UpdatedAt:  time.Unix(d.TimeUpdated, 0).UTC(),
+		FileSize:   int64(d.FileSize),
+		PreviewURL: d.PreviewURL,
+		Banned:     d.Banned,
+		BanReason:  d.BanReason,
+		Visibility: d.Visibility,
+		Revision:   int64(d.Revision),
+	}
+	if d.TimeCreated > 0 {
+		meta.CreatedAt = time.Unix(d.TimeCreated, 0).UTC()
+	}
+	for _, tag := range d.Tags {
+		meta.Tags = append(meta.Tags, tag.Tag)
+	}
+	for _, child := range d.Children {
+		meta.ChildIDs = append(meta.ChildIDs, child.PublishedFileID)
+	}
+	return meta
 }
 
 func parseMetadataResponse(resp *http.Response) (map[string]ModMetadata, error) {
 	var payload struct {
 		Response struct {
-			PublishedFileDetails []struct {
-				PublishedFileID string `json:"publishedfileid"`
-				Title           string `json:"title"`
-				TimeUpdated     int64  `json:"time_updated"`
-			} `json:"publishedfiledetails"`
+			PublishedFileDetails []publishedFileDetails `json:"publishedfiledetails"`
 		} `json:"response"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
@@ -242,15 +478,55 @@ func parseMetadataResponse(resp *http.Response) (map[string]ModMetadata, error)
 
 	mods := make(map[string]ModMetadata, len(payload.Response.PublishedFileDetails))
 	for _, detail := range payload.Response.PublishedFileDetails {
-		mods[detail.PublishedFileID] = ModMetadata{
-			ID:        detail.PublishedFileID,
-			Title:     detail.Title,
-			UpdatedAt: time.Unix(detail.TimeUpdated, 0).UTC(),
+		// Result 9 (not found) and other failures carry no details.
+		if detail.Result > 1 {
+			continue
 		}
+		mods[detail.PublishedFileID] = detail.metadata()
 	}
 	return mods, nil
 }
 
+// flexInt accepts a JSON number or a numeric string; the Web API encodes
+// 64-bit values either way depending on the endpoint.
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse integer %s: %w", b, err)
+	}
+	*n = flexInt(v)
+	return nil
+}
+
+// applyDetails copies the descriptive fields of meta into mod.
+func applyDetails(mod *state.ModState, meta ModMetadata) {
+	if meta.PreviewURL != "" {
+		mod.PreviewURL = meta.PreviewURL
+	}
+	if meta.Tags != nil {
+		mod.Tags = meta.Tags
+	}
+	if meta.ChildIDs != nil {
+		mod.ChildIDs = meta.ChildIDs
+	}
+	if !meta.CreatedAt.IsZero() {
+		mod.WorkshopCreatedAt = meta.CreatedAt
+	}
+	mod.Banned = meta.Banned
+	mod.BanReason = meta.BanReason
+	mod.Visibility = meta.Visibility
+	if meta.Revision != 0 {
+		mod.WorkshopRevision = meta.Revision
+	}
+}
+
 func mapKeys(set map[string]struct{}) []string {
 	keys := make([]string, 0, len(set))
 	for k := range set {
@@ -2,8 +2,11 @@ package workshop
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"sort"
 	"strings"
@@ -30,6 +33,17 @@ func TestParseMetadataResponseTimeUpdated(t *testing.T) {
 	}
 }
 
+func TestParseMetadataResponseFileSize(t *testing.T) {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(`{"response":{"publishedfiledetails":[{"publishedfileid":"1","file_size":1234},{"publishedfileid":"2","file_size":"5678"},{"publishedfileid":"3"}]}}`))}
+	got, err := parseMetadataResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["1"].FileSize != 1234 || got["2"].FileSize != 5678 || got["3"].FileSize != 0 {
+		t.Fatalf("unexpected file sizes: %+v", got)
+	}
+}
+
 func TestPollMetadataBatchingAndCache(t *testing.T) {
 	now := time.Unix(1700000100, 0).UTC()
 	cfg := config.Config{
@@ -109,12 +123,19 @@ type fakeClient struct {
 	mu       sync.Mutex
 	calls    [][]string
 	response map[string]ModMetadata
+	// failing fails every batch containing one of its IDs.
+	failing map[string]error
 }
 
 func (f *fakeClient) FetchMetadata(_ context.Context, modIDs []string) (map[string]ModMetadata, error) {
 	f.mu.Lock()
 	f.calls = append(f.calls, append([]string(nil), modIDs...))
 	f.mu.Unlock()
+	for _, id := range modIDs {
+		if err, ok := f.failing[id]; ok {
+			return nil, err
+		}
+	}
 	out := make(map[string]ModMetadata)
 	for _, id := range modIDs {
 		if m, ok := f.response[id]; ok {
@@ -129,3 +150,371 @@ func (f *fakeClient) callCount() int {
 	defer f.mu.Unlock()
 	return len(f.calls)
 }
+
+func TestParseMetadataResponseDetails(t *testing.T) {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(`{"response":{"publishedfiledetails":[
+		{"publishedfileid":"1","result":1,"title":"Mod 1","time_created":1600000000,"time_updated":1700000000,"file_size":"10","preview_url":"https://example.test/1.jpg","visibility":0,"banned":false,"ban_reason":"","tags":[{"tag":"Mod"},{"tag":"Server"}],"children":[{"publishedfileid":"7","sortorder":1}]},
+		{"publishedfileid":"2","result":1,"banned":true,"ban_reason":"Copyright","visibility":2},
+		{"publishedfileid":"3","result":9}
+	]}}`))}
+	got, err := parseMetadataResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["3"]; ok {
+		t.Fatalf("result 9 should be skipped: %+v", got["3"])
+	}
+	one := got["1"]
+	if !one.CreatedAt.Equal(time.Unix(1600000000, 0)) || one.PreviewURL != "https://example.test/1.jpg" {
+		t.Fatalf("unexpected details: %+v", one)
+	}
+	if !reflect.DeepEqual(one.Tags, []string{"Mod", "Server"}) || !reflect.DeepEqual(one.ChildIDs, []string{"7"}) {
+		t.Fatalf("unexpected tags/children: %+v", one)
+	}
+	if two := got["2"]; !two.Banned || two.BanReason != "Copyright" || two.Visibility != 2 {
+		t.Fatalf("unexpected ban/visibility: %+v", two)
+	}
+}
+
+func TestPublishedFileClientFetchMetadata(t *testing.T) {
+	var query url.Values
+	var key string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		query = r.URL.Query()
+		key = r.Header.Get("x-webapi-key")
+		io.WriteString(w, `{"response":{"publishedfiledetails":[{"publishedfileid":"42","result":1,"title":"Mod 42","time_updated":1700000000,"revision_change_number":"7","children":[{"publishedfileid":"43"}]}]}}`)
+	}))
+	defer srv.Close()
+
+	client := NewPublishedFileClient("secret", time.Second, 1, time.Millisecond)
+	client.endpoint = srv.URL
+	got, err := client.FetchMetadata(context.Background(), []string{"42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "secret" || query.Has("key") || query.Get("includechildren") != "true" || query.Get("publishedfileids[0]") != "42" {
+		t.Fatalf("unexpected query: %v", query)
+	}
+	if got["42"].Title != "Mod 42" || got["42"].Revision != 7 || !reflect.DeepEqual(got["42"].ChildIDs, []string{"43"}) {
+		t.Fatalf("unexpected metadata: %+v", got["42"])
+	}
+}
+
+func TestWorkshopClientErrorsDoNotLeakAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	endpoint := srv.URL
+	srv.Close()
+
+	published := NewPublishedFileClient("secret-key", time.Second, 1, time.Millisecond)
+	published.endpoint = endpoint
+	legacy := NewWebAPIClient("secret-key", time.Second, 1, time.Millisecond)
+	legacy.endpoint = endpoint + "/?key=secret-key"
+	for name, client := range map[string]Client{"published file": published, "remote storage": legacy} {
+		_, err := client.FetchMetadata(context.Background(), []string{"42"})
+		if err == nil {
+			t.Fatalf("%s: expected connection error", name)
+		}
+		if strings.Contains(err.Error(), "secret-key") {
+			t.Fatalf("%s: error leaks the api key: %v", name, err)
+		}
+	}
+}
+
+func TestNewClientBackend(t *testing.T) {
+	if _, ok := NewClient(config.SteamConfig{}).(*WebAPIClient); !ok {
+		t.Fatal("expected remote storage client by default")
+	}
+	if _, ok := NewClient(config.SteamConfig{WorkshopBackend: config.WorkshopBackendPublishedFileService, WebAPIKey: "k"}).(*PublishedFileClient); !ok {
+		t.Fatal("expected published file service client")
+	}
+}
+
+func TestPollMetadataStoresDetails(t *testing.T) {
+	now := time.Unix(1700000100, 0).UTC()
+	cfg := config.Config{Concurrency: config.ConcurrencyConfig{WorkshopBatchSize: 10, WorkshopParallelism: 1}}
+	st := state.State{
+		Mods:    map[string]state.ModState{"1": {Banned: true, BanReason: "old"}},
+		Servers: map[string]state.ServerState{"a": {LastModIDs: []string{"1"}}},
+	}
+	fc := &fakeClient{response: map[string]ModMetadata{
+		"1": {ID: "1", UpdatedAt: now, CreatedAt: now.Add(-time.Hour), PreviewURL: "p", Tags: []string{"Mod"}, ChildIDs: []string{"2"}, Visibility: 1, Revision: 3},
+	}}
+	if _, err := PollMetadata(context.Background(), cfg, &st, fc, now); err != nil {
+		t.Fatal(err)
+	}
+	mod := st.Mods["1"]
+	if mod.Banned || mod.BanReason != "" || mod.Visibility != 1 || mod.WorkshopRevision != 3 || mod.PreviewURL != "p" || !mod.WorkshopCreatedAt.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("unexpected mod state: %+v", mod)
+	}
+	if !reflect.DeepEqual(mod.Tags, []string{"Mod"}) || !reflect.DeepEqual(mod.ChildIDs, []string{"2"}) {
+		t.Fatalf("unexpected tags/children: %+v", mod)
+	}
+}
+
+const changelogPage = `<div class="detailBox workshopAnnouncement noFooter changeLogCtn">
+	<div class="changelog headline">Update: 14 Nov, 2023 @ 10:13pm</div>
+	<p id="1700000000">Fixed &quot;crash&quot; on login<br>Added <b>new</b> weapons<br /></p>
+</div>
+<div class="detailBox workshopAnnouncement noFooter changeLogCtn">
+	<div class="changelog headline">Update: 1 Nov, 2023 @ 8:00am</div>
+	<p id="1698825600">Older entry</p>
+</div>`
+
+func TestParseChangelog(t *testing.T) {
+	if got := parseChangelog(changelogPage, time.Unix(1700000000, 0)); got != "Fixed \"crash\" on login\nAdded new weapons" {
+		t.Fatalf("unexpected changelog: %q", got)
+	}
+	if got := parseChangelog(changelogPage, time.Unix(1700000001, 0)); got != "" {
+		t.Fatalf("expected no entry, got %q", got)
+	}
+}
+
+func TestFetchChangelogsStoresEntryForVersion(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/changelog/2" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, changelogPage)
+	}))
+	defer srv.Close()
+
+	updated := time.Unix(1700000000, 0).UTC()
+	st := state.State{Mods: map[string]state.ModState{
+		"1": {WorkshopUpdatedAt: updated, Changelog: "Older entry", ChangelogUpdatedAt: time.Unix(1698825600, 0).UTC()},
+		"2": {WorkshopUpdatedAt: updated},
+		"3": {WorkshopUpdatedAt: updated, Changelog: "cached", ChangelogUpdatedAt: updated},
+	}}
+	client := NewChangelogClient(config.SteamConfig{WorkshopHTTPTimeoutSeconds: 1, Changelog: config.ChangelogConfig{BaseURL: srv.URL + "/changelog/"}})
+	now := time.Unix(1700001000, 0).UTC()
+	due := DueChangelogs(&st, []string{"1", "2", "3"}, now)
+	err := ApplyChangelogs(&st, FetchChangelogs(context.Background(), client, due), now)
+	if err == nil || !strings.Contains(err.Error(), "mod 2") {
+		t.Fatalf("expected error for mod 2, got %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/changelog/1", "/changelog/2"}) {
+		t.Fatalf("unexpected requests: %v", paths)
+	}
+	if mod := st.Mods["1"]; !strings.HasPrefix(mod.Changelog, "Fixed") || !mod.ChangelogUpdatedAt.Equal(updated) {
+		t.Fatalf("unexpected mod 1 changelog: %+v", mod)
+	}
+	if st.Mods["2"].Changelog != "" || st.Mods["3"].Changelog != "cached" {
+		t.Fatalf("unexpected changelogs: %+v", st.Mods)
+	}
+	if !st.Mods["2"].ChangelogCheckedAt.Equal(now) {
+		t.Fatalf("expected failed attempt to be recorded: %+v", st.Mods["2"])
+	}
+	if due := DueChangelogs(&st, []string{"1", "2", "3"}, now.Add(time.Minute)); len(due) != 0 {
+		t.Fatalf("expected failed mod to back off, got %+v", due)
+	}
+	if due := DueChangelogs(&st, []string{"2"}, now.Add(changelogRetryInterval)); len(due) != 1 {
+		t.Fatalf("expected mod 2 to be retried after the interval, got %+v", due)
+	}
+}
+
+func TestBackoffDelayIsExponentialWithJitter(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt, want := range map[int]time.Duration{1: base, 3: 4 * base, 20: maxBackoff} {
+		for i := 0; i < 20; i++ {
+			if got := backoffDelay(base, attempt); got < want/2 || got > want {
+				t.Fatalf("attempt %d: delay %s outside [%s, %s]", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for header, want := range map[string]time.Duration{
+		"7":                             7 * time.Second,
+		"Wed, 01 Jan 2025 12:01:00 GMT": time.Minute,
+	} {
+		resp := &http.Response{Header: http.Header{"Retry-After": []string{header}}}
+		if got, ok := retryAfter(resp, now); !ok || got != want {
+			t.Fatalf("Retry-After %q = %s, %v; want %s", header, got, ok, want)
+		}
+	}
+	if _, ok := retryAfter(&http.Response{Header: http.Header{}}, now); ok {
+		t.Fatal("expected no Retry-After")
+	}
+}
+
+func TestWebAPIClientHonorsRetryAfter(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"response":{"publishedfiledetails":[{"publishedfileid":"1","result":1}]}}`)
+	}))
+	defer srv.Close()
+
+	client := NewWebAPIClient("", time.Second, 3, time.Millisecond)
+	client.endpoint = srv.URL
+	start := time.Now()
+	if _, err := client.FetchMetadata(context.Background(), []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond || requests != 2 {
+		t.Fatalf("expected one retry after ~1s, got %d requests after %s", requests, elapsed)
+	}
+}
+
+func TestWebAPIClientCircuitBreaker(t *testing.T) {
+	var requests int
+	retryAfterHeader := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if retryAfterHeader != "" {
+			w.Header().Set("Retry-After", retryAfterHeader)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := NewWebAPIClient("", time.Second, 1, time.Millisecond)
+	client.endpoint = srv.URL
+	client.limiter = newLimiter(0, 2, time.Minute)
+	client.limiter.now = func() time.Time { return now }
+	fetch := func() error {
+		_, err := client.FetchMetadata(context.Background(), []string{"1"})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := fetch(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("fetch %d: expected api error, got %v", i, err)
+		}
+	}
+	if err := fetch(); !errors.Is(err, ErrCircuitOpen) || requests != 2 {
+		t.Fatalf("expected open breaker without request, got %v after %d requests", err, requests)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := fetch(); err == nil || errors.Is(err, ErrCircuitOpen) || requests != 3 {
+		t.Fatalf("expected a trial request after cooldown, got %v after %d requests", err, requests)
+	}
+	if err := fetch(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected breaker to reopen after failed trial, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	retryAfterHeader = "3600"
+	if err := fetch(); err == nil || requests != 4 {
+		t.Fatalf("expected api error, got %v", err)
+	}
+	var open *CircuitOpenError
+	if err := fetch(); !errors.As(err, &open) || !open.Until.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected breaker open for Retry-After, got %v", err)
+	}
+}
+
+func TestPollIntervalAdaptsToUpdateAge(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	intervals := config.IntervalsConfig{WorkshopPollSeconds: 300, WorkshopPollMinSeconds: 60, WorkshopPollMaxSeconds: 1800}
+	for name, tc := range map[string]struct {
+		updated time.Time
+		want    time.Duration
+	}{
+		"unknown": {time.Time{}, 300 * time.Second},
+		"recent":  {now.Add(-time.Hour), 60 * time.Second},
+		"normal":  {now.Add(-7 * 24 * time.Hour), 300 * time.Second},
+		"stale":   {now.Add(-90 * 24 * time.Hour), 1800 * time.Second},
+	} {
+		if got := PollInterval(intervals, state.ModState{WorkshopUpdatedAt: tc.updated}, now); got != tc.want {
+			t.Fatalf("%s: interval %s, want %s", name, got, tc.want)
+		}
+	}
+}
+
+func TestFetchPollAppliesToCurrentState(t *testing.T) {
+	now := time.Unix(1700000100, 0).UTC()
+	cfg := config.Config{
+		Intervals:   config.IntervalsConfig{WorkshopPollSeconds: 300},
+		Concurrency: config.ConcurrencyConfig{WorkshopBatchSize: 10, WorkshopParallelism: 1},
+	}
+	snapshot := state.State{
+		Mods:    map[string]state.ModState{"1": {}},
+		Servers: map[string]state.ServerState{"a": {LastModIDs: []string{"1"}}},
+	}
+	fc := &fakeClient{response: map[string]ModMetadata{"1": {ID: "1", Title: "CF", UpdatedAt: now.Add(-time.Minute)}}}
+	poll, err := FetchPoll(context.Background(), cfg, fc, DueForPoll(cfg, &snapshot, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// State written by others while the request was in flight is kept.
+	current := state.State{
+		Mods:    map[string]state.ModState{"1": {FolderSlug: "cf"}},
+		Servers: map[string]state.ServerState{"a": {LastModIDs: []string{"1"}, NeedsShutdown: true}},
+	}
+	got, err := poll.Apply(&current, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("unexpected mods to update: %v", got)
+	}
+	if mod := current.Mods["1"]; mod.FolderSlug != "cf" || mod.LastTitle != "CF" || !mod.LastWorkshopCheckAt.Equal(now) {
+		t.Fatalf("unexpected mod state: %+v", mod)
+	}
+	if !current.Servers["a"].NeedsShutdown {
+		t.Fatal("expected concurrent server state to be kept")
+	}
+}
+
+func TestPollMetadataAppliesSuccessfulBatches(t *testing.T) {
+	now := time.Unix(1700000100, 0).UTC()
+	cfg := config.Config{
+		Intervals:   config.IntervalsConfig{WorkshopPollSeconds: 300},
+		Concurrency: config.ConcurrencyConfig{WorkshopBatchSize: 2, WorkshopParallelism: 2},
+	}
+	st := state.State{
+		Mods: map[string]state.ModState{
+			"1": {LastWorkshopError: "old failure"},
+			"3": {LocalUpdatedAt: now.Add(-time.Hour)},
+		},
+		Servers: map[string]state.ServerState{"a": {LastModIDs: []string{"1", "2", "3", "4"}}},
+	}
+	fc := &fakeClient{
+		response: map[string]ModMetadata{
+			"1": {ID: "1", UpdatedAt: now.Add(-time.Minute)},
+			"2": {ID: "2", UpdatedAt: now.Add(-time.Minute)},
+		},
+		failing: map[string]error{"3": errors.New("workshop api returned status 503")},
+	}
+
+	got, err := PollMetadata(context.Background(), cfg, &st, fc, now)
+	var pollErr *PollError
+	if !errors.As(err, &pollErr) {
+		t.Fatalf("expected poll error, got %v", err)
+	}
+	if !reflect.DeepEqual(pollErr.FailedIDs(), []string{"3", "4"}) || pollErr.Requested != 4 || len(pollErr.Batches) != 1 {
+		t.Fatalf("unexpected poll error: %+v", pollErr)
+	}
+	if !strings.Contains(err.Error(), "2 of 4 mods in 1 batch(es): workshop api returned status 503") {
+		t.Fatalf("unexpected summary: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"1", "2", "4"}) {
+		t.Fatalf("unexpected mods needing local update: %#v", got)
+	}
+	for _, id := range []string{"1", "2"} {
+		if mod := st.Mods[id]; !mod.LastWorkshopCheckAt.Equal(now) || mod.LastWorkshopError != "" {
+			t.Fatalf("mod %s: expected successful check, got %+v", id, mod)
+		}
+	}
+	for _, id := range []string{"3", "4"} {
+		if mod := st.Mods[id]; !mod.LastWorkshopCheckAt.IsZero() || mod.LastWorkshopError != "workshop api returned status 503" {
+			t.Fatalf("mod %s: expected failed check to be recorded, got %+v", id, mod)
+		}
+	}
+}
@@ -116,7 +116,7 @@ func TestOrchestratorWorkshopSteamCMDSFTPSyncFlow(t *testing.T) {
 		&mockSteamRunner{localModsRoot: localMods},
 		sftpsync.NewEngine(),
 		noopRCONTicker{},
-		func(ctx context.Context, srv config.ServerConfig, localCacheRoot string, warnf func(string, ...any)) (modlist.PollResult, error) {
+		func(ctx context.Context, srv config.ServerConfig, localCacheRoot string, prev *state.RemoteFileStat, warnf func(string, ...any)) (modlist.PollResult, error) {
 			return modlist.PollResult{}, nil
 		},
 		func() time.Time { return time.Now().UTC() },
@@ -73,3 +73,7 @@ func (c *Command) Flags() *FlagSet {
 func (f *FlagSet) StringVar(p *string, name string, value string, usage string) {
 	f.inner.StringVar(p, name, value, usage)
 }
+
+func (f *FlagSet) BoolVar(p *bool, name string, value bool, usage string) {
+	f.inner.BoolVar(p, name, value, usage)
+}
@@ -53,3 +53,25 @@ func Dial(network, address string, config *ClientConfig) (*Client, error) {
 func (c *Client) Close() error {
 	return nil
 }
+
+func (c *Client) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	_ = name
+	_ = wantReply
+	_ = payload
+	return true, nil, nil
+}
+
+type Session struct{}
+
+func (c *Client) NewSession() (*Session, error) {
+	return &Session{}, nil
+}
+
+func (s *Session) Output(cmd string) ([]byte, error) {
+	_ = cmd
+	return nil, nil
+}
+
+func (s *Session) Close() error {
+	return nil
+}
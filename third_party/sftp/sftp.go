@@ -2,6 +2,7 @@ package sftp
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/fs"
 	"os"
@@ -12,6 +13,11 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+var (
+	ErrSSHFxConnectionLost = errors.New("connection lost")
+	ErrSSHFxNoConnection   = errors.New("no connection")
+)
+
 type Client struct{}
 
 type Walker struct{}
@@ -20,17 +26,64 @@ type File struct {
 	bytes.Buffer
 }
 
-func NewClient(conn *ssh.Client) (*Client, error) {
+type ClientOption func(*Client) error
+
+func MaxConcurrentRequestsPerFile(n int) ClientOption {
+	return func(c *Client) error { _ = n; return nil }
+}
+
+func UseConcurrentWrites(value bool) ClientOption {
+	return func(c *Client) error { _ = value; return nil }
+}
+
+func NewClient(conn *ssh.Client, opts ...ClientOption) (*Client, error) {
 	_ = conn
-	return &Client{}, nil
+	c := &Client{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 func (c *Client) Close() error { return nil }
 
+type StatVFS struct {
+	ID      uint32
+	Bsize   uint64
+	Frsize  uint64
+	Blocks  uint64
+	Bfree   uint64
+	Bavail  uint64
+	Files   uint64
+	Ffree   uint64
+	Favail  uint64
+	Fsid    uint64
+	Flag    uint64
+	Namemax uint64
+}
+
+func (p *StatVFS) TotalSpace() uint64 { return p.Frsize * p.Blocks }
+
+func (p *StatVFS) FreeSpace() uint64 { return p.Frsize * p.Bfree }
+
+func (c *Client) HasExtension(name string) (string, bool) { _ = name; return "", false }
+
+func (c *Client) StatVFS(path string) (*StatVFS, error) {
+	_ = path
+	return nil, errors.New("sftp: statvfs@openssh.com not supported")
+}
+
 func (c *Client) MkdirAll(path string) error { _ = path; return nil }
 
 func (c *Client) Create(path string) (io.WriteCloser, error) { _ = path; return nopWriteCloser{}, nil }
 
+func (c *Client) OpenFile(path string, f int) (*File, error) {
+	_, _ = path, f
+	return &File{}, nil
+}
+
 func (c *Client) Open(path string) (io.ReadCloser, error) {
 	_ = path
 	return io.NopCloser(bytes.NewReader(nil)), nil
@@ -47,7 +100,12 @@ func (c *Client) Chtimes(path string, atime, mtime time.Time) error {
 	return nil
 }
 
-func (c *Client) Stat(path string) (os.FileInfo, error) { _ = path; return fakeInfo{}, nil }
+func (c *Client) Stat(path string) (os.FileInfo, error) {
+	if strings.HasSuffix(path, "/missing.html") {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return fakeInfo{}, nil
+}
 
 func (c *Client) Walk(root string) *Walker { _ = root; return &Walker{} }
 
@@ -59,6 +117,17 @@ func (w *Walker) Stat() os.FileInfo { return fakeInfo{} }
 
 func (w *Walker) Path() string { return "" }
 
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	_, _ = offset, whence
+	return 0, nil
+}
+
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	return bytes.NewReader(f.Bytes()).ReadAt(b, off)
+}
+
+func (f *File) Close() error { return nil }
+
 type nopWriteCloser struct{}
 
 func (n nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }